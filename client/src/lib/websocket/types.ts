@@ -1,8 +1,19 @@
 export interface WebSocketMessage {
-  type: 'message' | 'system' | 'join'
+  type: 'message' | 'system' | 'join' | 'history' | 'expired' | 'room_expired' | 'session' | 'ack' | 'gap' | 'key_bundle' | 'key_request' | 'key_share' | 'rekey_required' | 'stale_epoch' | 'join_denied' | 'room_settings' | 'configure_room' | 'create_invite' | 'invite' | 'kick' | 'ban' | 'mute' | 'lock' | 'unlock' | 'moderation' | 'presence' | 'roster' | 'typing' | 'identity' | 'direct' | 'direct_sent' | 'direct_ack' | 'edit' | 'delete' | 'react' | 'thread_history' | 'subscribe_thread' | 'unsubscribe_thread' | 'threads' | 'read' | 'receipts' | 'file_begin' | 'file_ready' | 'file_chunk' | 'file_ack' | 'file_end' | 'file_get' | 'file'
   payload: any
+  id?: string
+  seq?: number
   timestamp?: number
-  sessionId?: string
+  ttl?: number
+  expiresAt?: number
+  signature?: string
+  sender?: string
+  to?: string
+  handle?: string
+  replyTo?: string
+  threadId?: string
+  editedAt?: number
+  reactions?: Record<string, string[]>
 }
 
 export type WebSocketState = {
@@ -0,0 +1,6 @@
+ALTER TABLE messages DROP CONSTRAINT IF EXISTS messages_room_id_fkey;
+ALTER TABLE messages ALTER COLUMN room_id DROP NOT NULL;
+ALTER TABLE messages ALTER COLUMN room_id TYPE UUID USING room_id::uuid;
+ALTER TABLE rooms ALTER COLUMN id TYPE UUID USING id::uuid;
+ALTER TABLE messages
+  ADD CONSTRAINT messages_room_id_fkey FOREIGN KEY (room_id) REFERENCES rooms(id) ON DELETE CASCADE;
@@ -0,0 +1,7 @@
+-- Room IDs are chosen by clients and are not necessarily UUIDs
+ALTER TABLE messages DROP CONSTRAINT IF EXISTS messages_room_id_fkey;
+ALTER TABLE rooms ALTER COLUMN id TYPE TEXT;
+ALTER TABLE messages ALTER COLUMN room_id TYPE TEXT;
+ALTER TABLE messages ALTER COLUMN room_id SET NOT NULL;
+ALTER TABLE messages
+  ADD CONSTRAINT messages_room_id_fkey FOREIGN KEY (room_id) REFERENCES rooms(id) ON DELETE CASCADE;
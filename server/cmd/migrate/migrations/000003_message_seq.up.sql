@@ -0,0 +1,18 @@
+ALTER TABLE rooms ADD COLUMN IF NOT EXISTS last_seq BIGINT NOT NULL DEFAULT 0;
+ALTER TABLE messages ADD COLUMN IF NOT EXISTS seq BIGINT;
+
+-- Number already stored messages in insertion order
+UPDATE messages m
+SET seq = numbered.seq
+FROM (
+  SELECT id, ROW_NUMBER() OVER (PARTITION BY room_id ORDER BY created_at, id) AS seq
+  FROM messages
+) numbered
+WHERE m.id = numbered.id;
+
+UPDATE rooms r
+SET last_seq = COALESCE((SELECT MAX(seq) FROM messages WHERE room_id = r.id), 0);
+
+ALTER TABLE messages ALTER COLUMN seq SET NOT NULL;
+
+CREATE UNIQUE INDEX IF NOT EXISTS messages_room_id_seq_idx ON messages(room_id, seq);
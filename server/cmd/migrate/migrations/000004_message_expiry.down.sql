@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS messages_expires_at_idx;
+ALTER TABLE messages DROP COLUMN IF EXISTS expires_at;
@@ -0,0 +1,3 @@
+ALTER TABLE messages ADD COLUMN IF NOT EXISTS expires_at TIMESTAMPTZ;
+
+CREATE INDEX IF NOT EXISTS messages_expires_at_idx ON messages(expires_at) WHERE expires_at IS NOT NULL;
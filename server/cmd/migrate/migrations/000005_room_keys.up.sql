@@ -0,0 +1,8 @@
+-- Per-room data keys, wrapped by the configured key provider. Deleting a row
+-- makes the room's stored messages in this database unreadable; backups taken
+-- before still hold the key.
+CREATE TABLE IF NOT EXISTS room_keys (
+    room_id TEXT PRIMARY KEY REFERENCES rooms(id) ON DELETE CASCADE,
+    wrapped_key BYTEA NOT NULL,
+    created_at TIMESTAMPTZ DEFAULT NOW()
+);
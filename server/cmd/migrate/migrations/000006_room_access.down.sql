@@ -0,0 +1,5 @@
+DROP TABLE IF EXISTS room_invites;
+ALTER TABLE rooms DROP COLUMN IF EXISTS max_members;
+ALTER TABLE rooms DROP COLUMN IF EXISTS password_hash;
+ALTER TABLE rooms DROP COLUMN IF EXISTS join_policy;
+ALTER TABLE rooms DROP COLUMN IF EXISTS owner;
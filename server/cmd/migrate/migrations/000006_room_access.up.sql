@@ -0,0 +1,11 @@
+ALTER TABLE rooms ADD COLUMN IF NOT EXISTS owner TEXT;
+ALTER TABLE rooms ADD COLUMN IF NOT EXISTS join_policy TEXT NOT NULL DEFAULT 'open';
+ALTER TABLE rooms ADD COLUMN IF NOT EXISTS password_hash BYTEA;
+ALTER TABLE rooms ADD COLUMN IF NOT EXISTS max_members INTEGER NOT NULL DEFAULT 0;
+
+-- Single-use invite codes, stored as digests
+CREATE TABLE IF NOT EXISTS room_invites (
+    code_hash BYTEA PRIMARY KEY,
+    room_id TEXT NOT NULL REFERENCES rooms(id) ON DELETE CASCADE,
+    expires_at TIMESTAMPTZ NOT NULL
+);
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS room_bans;
+ALTER TABLE rooms DROP COLUMN IF EXISTS locked;
@@ -0,0 +1,9 @@
+ALTER TABLE rooms ADD COLUMN IF NOT EXISTS locked BOOLEAN NOT NULL DEFAULT false;
+
+-- Bans by session ID or key fingerprint
+CREATE TABLE IF NOT EXISTS room_bans (
+    room_id TEXT NOT NULL REFERENCES rooms(id) ON DELETE CASCADE,
+    target TEXT NOT NULL,
+    expires_at TIMESTAMPTZ NOT NULL,
+    PRIMARY KEY (room_id, target)
+);
@@ -0,0 +1,21 @@
+-- Identities that registered a signing key. Each has its own wrapped data
+-- key sealing the direct messages queued for it.
+CREATE TABLE IF NOT EXISTS identities (
+    fingerprint TEXT PRIMARY KEY,
+    public_key BYTEA NOT NULL,
+    wrapped_key BYTEA NOT NULL,
+    created_at TIMESTAMPTZ DEFAULT NOW(),
+    last_seen TIMESTAMPTZ DEFAULT NOW()
+);
+
+-- Direct messages waiting for their recipient to come online and ack them
+CREATE TABLE IF NOT EXISTS direct_messages (
+    id UUID PRIMARY KEY,
+    recipient TEXT NOT NULL REFERENCES identities(fingerprint) ON DELETE CASCADE,
+    content BYTEA NOT NULL,
+    created_at TIMESTAMPTZ DEFAULT NOW(),
+    expires_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS direct_messages_recipient_idx ON direct_messages(recipient, created_at);
+CREATE INDEX IF NOT EXISTS direct_messages_expires_at_idx ON direct_messages(expires_at);
@@ -0,0 +1,3 @@
+-- Identity fingerprint or session a message came from. Only the author may
+-- edit or delete it; older rows have none and cannot be changed.
+ALTER TABLE messages ADD COLUMN IF NOT EXISTS author TEXT;
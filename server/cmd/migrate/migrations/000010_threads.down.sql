@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS messages_thread_id_idx;
+ALTER TABLE messages DROP COLUMN IF EXISTS thread_id;
@@ -0,0 +1,4 @@
+-- ID of the first message of the thread a reply belongs to
+ALTER TABLE messages ADD COLUMN IF NOT EXISTS thread_id TEXT;
+
+CREATE INDEX IF NOT EXISTS messages_thread_id_idx ON messages(room_id, thread_id, seq) WHERE thread_id IS NOT NULL;
@@ -0,0 +1,15 @@
+-- How far each member has read a room, replacing the single is_read flag,
+-- which cannot express that in a group. member is an identity fingerprint or
+-- session; reader is how other members see it.
+CREATE TABLE IF NOT EXISTS read_markers (
+    room_id TEXT NOT NULL REFERENCES rooms(id) ON DELETE CASCADE,
+    member TEXT NOT NULL,
+    reader TEXT NOT NULL,
+    seq BIGINT NOT NULL,
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (room_id, member)
+);
+
+CREATE INDEX IF NOT EXISTS read_markers_updated_at_idx ON read_markers(room_id, updated_at);
+
+ALTER TABLE messages DROP COLUMN IF EXISTS is_read;
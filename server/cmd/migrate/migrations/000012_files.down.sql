@@ -0,0 +1,2 @@
+SELECT lo_unlink(content) FROM files;
+DROP TABLE IF EXISTS files;
@@ -0,0 +1,16 @@
+-- Chunked file uploads. Content lives in a large object per file; there is
+-- no foreign key to rooms, since large objects must be unlinked before their
+-- rows are deleted, which a cascade would skip.
+CREATE TABLE IF NOT EXISTS files (
+    id TEXT PRIMARY KEY,
+    room_id TEXT NOT NULL,
+    owner TEXT NOT NULL,
+    metadata BYTEA,
+    size BIGINT NOT NULL,
+    received BIGINT NOT NULL DEFAULT 0,
+    content OID NOT NULL,
+    complete BOOLEAN NOT NULL DEFAULT false,
+    created_at TIMESTAMPTZ DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS files_room_id_idx ON files(room_id);
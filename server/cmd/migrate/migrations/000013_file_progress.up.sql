@@ -0,0 +1,2 @@
+-- Last progress of an upload, so stalled ones can be deleted
+ALTER TABLE files ADD COLUMN IF NOT EXISTS updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW();
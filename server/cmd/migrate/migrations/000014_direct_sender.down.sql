@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS direct_messages_sender_idx;
+ALTER TABLE direct_messages DROP COLUMN IF EXISTS sender;
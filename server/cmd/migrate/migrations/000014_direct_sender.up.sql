@@ -0,0 +1,3 @@
+-- Who queued each direct message, so one sender cannot fill a recipient's queue
+ALTER TABLE direct_messages ADD COLUMN IF NOT EXISTS sender TEXT NOT NULL DEFAULT '';
+CREATE INDEX IF NOT EXISTS direct_messages_sender_idx ON direct_messages(recipient, sender);
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"log"
+	"os"
+	"os/signal"
+
+	"github.com/fromscript/hush/internal/crypto"
+	"github.com/fromscript/hush/internal/database"
+	"github.com/joho/godotenv"
+)
+
+// rotate-keys moves messages sealed directly with a master key to their room
+// keys, then wraps every room and identity key again with the current
+// key-encryption key, so retired master key versions can be removed afterwards.
+func main() {
+	batchSize := flag.Int("batch", 500, "messages re-encrypted per transaction")
+	flag.Parse()
+
+	// Load environment variables from .env if it exists
+	err := godotenv.Load()
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		log.Fatalf("Error loading .env file: %v", err)
+	}
+
+	kms, legacy, err := crypto.LoadKeyProvider()
+	if err != nil {
+		log.Fatalf("Failed to load keys: %v", err)
+	}
+
+	db, err := database.Open(os.Getenv("DATABASE_URL"))
+	if err != nil {
+		log.Fatalf("Failed to connect to database: %v", err)
+	}
+	store := database.NewPostgresStore(db, kms, legacy)
+	defer store.Close()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	total := 0
+	for {
+		n, err := store.Reencrypt(ctx, *batchSize)
+		if err != nil {
+			log.Fatalf("Re-encryption stopped after %d messages: %v", total, err)
+		}
+		if n == 0 {
+			break
+		}
+		total += n
+		log.Printf("Re-encrypted %d messages", total)
+	}
+	log.Printf("Done, %d messages re-encrypted", total)
+
+	rooms := 0
+	for after := ""; ; {
+		after, err = store.RewrapRoomKeys(ctx, after, *batchSize)
+		if err != nil {
+			log.Fatalf("Rewrapping stopped after %d rooms: %v", rooms, err)
+		}
+		if after == "" {
+			break
+		}
+		rooms += *batchSize
+		log.Printf("Rewrapped keys of up to %d rooms", rooms)
+	}
+	log.Println("Done, all room keys rewrapped")
+
+	identities := 0
+	for after := ""; ; {
+		after, err = store.RewrapIdentityKeys(ctx, after, *batchSize)
+		if err != nil {
+			log.Fatalf("Rewrapping stopped after %d identities: %v", identities, err)
+		}
+		if after == "" {
+			break
+		}
+		identities += *batchSize
+		log.Printf("Rewrapped keys of up to %d identities", identities)
+	}
+	log.Println("Done, all identity keys rewrapped")
+}
@@ -1,15 +1,83 @@
 package main
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/fromscript/hush/internal/auth"
+	"github.com/fromscript/hush/internal/cluster"
+	"github.com/fromscript/hush/internal/crypto"
+	"github.com/fromscript/hush/internal/database"
+	"github.com/fromscript/hush/internal/metrics"
 	"github.com/fromscript/hush/internal/websocket"
+	"github.com/fromscript/hush/internal/websocket/models"
+	"github.com/joho/godotenv"
 	"log"
 	"net/http"
+	"os"
+	"strconv"
 	"time"
 )
 
 func main() {
-	manager := websocket.NewDefaultManager("development-token")
+	// Load environment variables from .env if it exists
+	err := godotenv.Load()
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		log.Fatalf("Error loading .env file: %v", err)
+	}
+
+	tokens, err := auth.NewSigner([]byte(os.Getenv("JWT_SECRET")), auth.Audience())
+	if err != nil {
+		log.Fatalf("Invalid JWT_SECRET: %v", err)
+	}
+
+	store, bus, seal, err := newBackends()
+	if err != nil {
+		log.Fatalf("Failed to initialize storage: %v", err)
+	}
+	defer store.Close()
+	defer bus.Close()
+	if seal != nil {
+		go serveUnseal(seal)
+	}
+
+	collector := metrics.NewPrometheusCollector()
+	go serveMetrics(collector)
+	opts := []websocket.Option{
+		websocket.WithMessageStore(store),
+		websocket.WithBus(bus),
+		websocket.WithMetricsCollector(collector),
+	}
+	files, err := newFileStore()
+	if err != nil {
+		log.Fatalf("Failed to initialize file storage: %v", err)
+	}
+	if files != nil {
+		defer files.Close()
+		quota, err := fileQuota()
+		if err != nil {
+			log.Fatalf("Invalid FILE_ROOM_QUOTA: %v", err)
+		}
+		opts = append(opts, websocket.WithFileStore(files, quota))
+	}
+	if v := os.Getenv("ROOM_EXPIRY"); v != "" {
+		roomExpiry, err := time.ParseDuration(v)
+		if err != nil {
+			log.Fatalf("Invalid ROOM_EXPIRY: %v", err)
+		}
+		opts = append(opts, websocket.WithRoomExpiry(roomExpiry))
+	}
+	if v := os.Getenv("SLOW_CONSUMER_POLICY"); v != "" {
+		policy, err := models.ParseSlowConsumerPolicy(v)
+		if err != nil {
+			log.Fatalf("Invalid SLOW_CONSUMER_POLICY: %v", err)
+		}
+		opts = append(opts, websocket.WithSlowConsumerPolicy(policy))
+	}
+
+	manager := websocket.NewDefaultManager(tokens, opts...)
 
 	http.HandleFunc("/ws", manager.UpgradeHandler)
 	http.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
@@ -18,9 +86,131 @@ func main() {
 		json.NewEncoder(w).Encode(map[string]interface{}{
 			"status":  "ok",
 			"version": "1.0.0",
+			"sealed":  seal != nil && seal.Sealed(),
 			"time":    time.Now().UTC().Format(time.RFC3339),
 		})
 	})
 	log.Println("Server starting on :8080")
 	log.Fatal(http.ListenAndServe(":8080", nil))
 }
+
+// newBackends persists to and relays between replicas through Postgres when
+// DATABASE_URL is set, and falls back to a single in-memory replica otherwise.
+// With UNSEAL_THRESHOLD set, the master key is recombined from Shamir shares
+// submitted at runtime; until then messages are kept in memory only, so a
+// sealed server runs as a single replica.
+func newBackends() (database.MessageStore, cluster.Bus, *unsealer, error) {
+	dsn := os.Getenv("DATABASE_URL")
+	if dsn == "" {
+		log.Println("DATABASE_URL not set, messages are kept in memory only")
+		return database.NewMemoryStore(0), cluster.NewLocalBus(), nil, nil
+	}
+
+	if v := os.Getenv("UNSEAL_THRESHOLD"); v != "" {
+		return newSealedBackends(dsn, v)
+	}
+
+	kms, legacy, err := crypto.LoadKeyProvider()
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	db, err := database.Open(dsn)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	return database.NewPostgresStore(db, kms, legacy), cluster.NewPostgresBus(db, dsn), nil, nil
+}
+
+func newSealedBackends(dsn, threshold string) (database.MessageStore, cluster.Bus, *unsealer, error) {
+	m, err := strconv.Atoi(threshold)
+	if err != nil || m < 2 {
+		return nil, nil, nil, fmt.Errorf("UNSEAL_THRESHOLD must be a number of at least 2, got %q", threshold)
+	}
+	check := os.Getenv("UNSEAL_KEY_CHECK")
+	if check == "" {
+		return nil, nil, nil, errors.New("UNSEAL_KEY_CHECK is required with UNSEAL_THRESHOLD")
+	}
+	// The recombined key wraps room keys itself; a key file would keep them
+	// readable without the shares
+	if os.Getenv("KMS_KEY_FILE") != "" {
+		return nil, nil, nil, errors.New("KMS_KEY_FILE cannot be combined with UNSEAL_THRESHOLD")
+	}
+
+	db, err := database.Open(dsn)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	store := database.NewDeferredStore(database.NewMemoryStore(0))
+	seal := newUnsealer(m, check, func(key []byte) error {
+		keys, err := crypto.NewKeyring(crypto.Key{ID: 1, Material: bytes.Clone(key)})
+		if err != nil {
+			return err
+		}
+		return store.Attach(context.Background(), database.NewPostgresStore(db, crypto.NewKeyringProvider(keys), keys))
+	})
+	log.Printf("Storage sealed, waiting for %d key shares; messages are kept in memory only", m)
+	// Each sealed replica numbers its rooms in its own memory, so relaying
+	// between replicas would mix up sequences and spilled references
+	return store, cluster.NewLocalBus(), seal, nil
+}
+
+// newFileStore keeps uploaded files in FILE_DIR with FILE_STORAGE=disk, or
+// in Postgres large objects with FILE_STORAGE=postgres. File transfer is off
+// when FILE_STORAGE is unset.
+func newFileStore() (database.FileStore, error) {
+	switch storage := os.Getenv("FILE_STORAGE"); storage {
+	case "":
+		return nil, nil
+	case "disk":
+		dir := os.Getenv("FILE_DIR")
+		if dir == "" {
+			dir = "files"
+		}
+		return database.NewDiskFileStore(dir)
+	case "postgres":
+		db, err := database.Open(os.Getenv("DATABASE_URL"))
+		if err != nil {
+			return nil, err
+		}
+		return database.NewPostgresFileStore(db), nil
+	default:
+		return nil, fmt.Errorf("unknown FILE_STORAGE %q, want disk or postgres", storage)
+	}
+}
+
+// fileQuota reads FILE_ROOM_QUOTA in bytes; zero means the default.
+func fileQuota() (int64, error) {
+	v := os.Getenv("FILE_ROOM_QUOTA")
+	if v == "" {
+		return 0, nil
+	}
+	return strconv.ParseInt(v, 10, 64)
+}
+
+// serveUnseal listens on a separate, by default loopback-only, address so
+// shares never travel over the public listener.
+func serveUnseal(seal *unsealer) {
+	addr := os.Getenv("UNSEAL_ADDR")
+	if addr == "" {
+		addr = "127.0.0.1:8081"
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/unseal", seal)
+	log.Printf("Unseal endpoint listening on %s", addr)
+	log.Fatal(http.ListenAndServe(addr, mux))
+}
+
+// serveMetrics keeps /metrics off the public listener, on a loopback-only
+// address unless METRICS_ADDR says otherwise.
+func serveMetrics(collector http.Handler) {
+	addr := os.Getenv("METRICS_ADDR")
+	if addr == "" {
+		addr = "127.0.0.1:9090"
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", collector)
+	log.Printf("Metrics listening on %s", addr)
+	log.Fatal(http.ListenAndServe(addr, mux))
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"sync"
+
+	"github.com/fromscript/hush/internal/crypto"
+)
+
+const maxShareRequestSize = 4096
+
+var (
+	errAlreadyUnsealed = errors.New("already unsealed")
+	errKeyCheck        = errors.New("shares do not recombine to the expected key, all submitted shares were discarded")
+)
+
+// unsealer collects Shamir shares of the storage master key until threshold
+// of them are in, then hands the recombined key to unseal. Shares are only
+// kept in memory.
+type unsealer struct {
+	mu        sync.Mutex
+	threshold int
+	check     string
+	shares    map[byte][]byte
+	sealed    bool
+	unseal    func(key []byte) error
+}
+
+type unsealStatus struct {
+	Sealed    bool `json:"sealed"`
+	Received  int  `json:"received"`
+	Threshold int  `json:"threshold"`
+}
+
+func newUnsealer(threshold int, check string, unseal func(key []byte) error) *unsealer {
+	return &unsealer{
+		threshold: threshold,
+		check:     check,
+		shares:    make(map[byte][]byte),
+		sealed:    true,
+		unseal:    unseal,
+	}
+}
+
+func (u *unsealer) Sealed() bool {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	return u.sealed
+}
+
+func (u *unsealer) status() unsealStatus {
+	return unsealStatus{Sealed: u.sealed, Received: len(u.shares), Threshold: u.threshold}
+}
+
+// Submit adds a share; resubmitting a share replaces it.
+func (u *unsealer) Submit(share []byte) (unsealStatus, error) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	if !u.sealed {
+		return u.status(), errAlreadyUnsealed
+	}
+	if len(share) < 2 || share[0] == 0 {
+		return u.status(), crypto.ErrInvalidShares
+	}
+	u.shares[share[0]] = bytes.Clone(share)
+	if len(u.shares) < u.threshold {
+		return u.status(), nil
+	}
+
+	shares := make([][]byte, 0, len(u.shares))
+	for _, s := range u.shares {
+		shares = append(shares, s)
+	}
+	key, err := crypto.CombineShares(shares)
+	u.discardShares()
+	if err != nil {
+		return u.status(), err
+	}
+	defer clear(key)
+	if crypto.KeyCheck(key) != u.check {
+		return u.status(), errKeyCheck
+	}
+	if err := u.unseal(key); err != nil {
+		return u.status(), err
+	}
+	u.sealed = false
+	log.Println("Storage unsealed, persistent rooms are available")
+	return u.status(), nil
+}
+
+func (u *unsealer) discardShares() {
+	for x, share := range u.shares {
+		clear(share)
+		delete(u.shares, x)
+	}
+}
+
+// ServeHTTP reports the unseal status on GET and takes a share on POST as
+// {"share": "<base64url>"}.
+func (u *unsealer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var (
+		status unsealStatus
+		err    error
+	)
+	switch r.Method {
+	case http.MethodGet:
+		u.mu.Lock()
+		status = u.status()
+		u.mu.Unlock()
+	case http.MethodPost:
+		var req struct {
+			Share string `json:"share"`
+		}
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxShareRequestSize)).Decode(&req); err != nil {
+			http.Error(w, "invalid request body", http.StatusBadRequest)
+			return
+		}
+		share, decodeErr := base64.RawURLEncoding.DecodeString(req.Share)
+		if decodeErr != nil {
+			http.Error(w, "share is not base64url", http.StatusBadRequest)
+			return
+		}
+		status, err = u.Submit(share)
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err != nil {
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"error":  err.Error(),
+			"status": status,
+		})
+		return
+	}
+	json.NewEncoder(w).Encode(status)
+}
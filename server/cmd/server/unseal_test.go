@@ -0,0 +1,150 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/fromscript/hush/internal/crypto"
+)
+
+func newTestUnsealer(t *testing.T, key []byte, n, threshold int) (*unsealer, [][]byte, *[]byte) {
+	t.Helper()
+	shares, err := crypto.SplitSecret(key, n, threshold)
+	if err != nil {
+		t.Fatal(err)
+	}
+	unsealed := new([]byte)
+	u := newUnsealer(threshold, crypto.KeyCheck(key), func(key []byte) error {
+		*unsealed = bytes.Clone(key)
+		return nil
+	})
+	return u, shares, unsealed
+}
+
+func TestUnsealerUnsealsAtThreshold(t *testing.T) {
+	key := bytes.Repeat([]byte{7}, 32)
+	u, shares, unsealed := newTestUnsealer(t, key, 5, 3)
+
+	for i, share := range shares[:2] {
+		status, err := u.Submit(share)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !status.Sealed || status.Received != i+1 {
+			t.Fatalf("after %d shares: %+v", i+1, status)
+		}
+	}
+	// Resubmitting a share does not count twice
+	if status, _ := u.Submit(shares[1]); status.Received != 2 {
+		t.Fatalf("resubmitted share counted: %+v", status)
+	}
+	status, err := u.Submit(shares[4])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.Sealed || u.Sealed() {
+		t.Fatal("still sealed after the threshold")
+	}
+	if !bytes.Equal(*unsealed, key) {
+		t.Error("unseal got the wrong key")
+	}
+	if _, err := u.Submit(shares[0]); !errors.Is(err, errAlreadyUnsealed) {
+		t.Errorf("got %v, want errAlreadyUnsealed", err)
+	}
+}
+
+func TestUnsealerDiscardsSharesOnWrongKey(t *testing.T) {
+	key := bytes.Repeat([]byte{7}, 32)
+	u, shares, unsealed := newTestUnsealer(t, key, 3, 2)
+	other, err := crypto.SplitSecret(bytes.Repeat([]byte{9}, 32), 3, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	u.Submit(shares[0])
+	status, err := u.Submit(other[1])
+	if !errors.Is(err, errKeyCheck) {
+		t.Fatalf("got %v, want errKeyCheck", err)
+	}
+	if !status.Sealed || status.Received != 0 || *unsealed != nil {
+		t.Fatalf("wrong key was not discarded: %+v", status)
+	}
+
+	u.Submit(shares[0])
+	if _, err := u.Submit(shares[2]); err != nil {
+		t.Fatal(err)
+	}
+	if u.Sealed() {
+		t.Error("still sealed after resubmitting good shares")
+	}
+}
+
+func TestUnsealerStaysSealedWhenUnsealFails(t *testing.T) {
+	key := bytes.Repeat([]byte{7}, 32)
+	shares, err := crypto.SplitSecret(key, 2, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	u := newUnsealer(2, crypto.KeyCheck(key), func([]byte) error {
+		return errors.New("database unavailable")
+	})
+
+	u.Submit(shares[0])
+	if _, err := u.Submit(shares[1]); err == nil {
+		t.Fatal("expected the unseal error")
+	}
+	if !u.Sealed() {
+		t.Error("unsealed although unseal failed")
+	}
+}
+
+func TestUnsealerRejectsMalformedShares(t *testing.T) {
+	u, _, _ := newTestUnsealer(t, bytes.Repeat([]byte{7}, 32), 3, 2)
+	for _, share := range [][]byte{nil, {1}, {0, 1, 2}} {
+		if _, err := u.Submit(share); !errors.Is(err, crypto.ErrInvalidShares) {
+			t.Errorf("share %v: got %v, want ErrInvalidShares", share, err)
+		}
+	}
+}
+
+func TestUnsealerHTTP(t *testing.T) {
+	key := bytes.Repeat([]byte{7}, 32)
+	u, shares, _ := newTestUnsealer(t, key, 3, 2)
+
+	submit := func(body string) (*httptest.ResponseRecorder, unsealStatus) {
+		rec := httptest.NewRecorder()
+		u.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/unseal", strings.NewReader(body)))
+		var status unsealStatus
+		json.NewDecoder(rec.Body).Decode(&status)
+		return rec, status
+	}
+
+	if rec, _ := submit(`{"share": "not base64!"}`); rec.Code != http.StatusBadRequest {
+		t.Errorf("bad share: status %d", rec.Code)
+	}
+	if rec, _ := submit(`{`); rec.Code != http.StatusBadRequest {
+		t.Errorf("bad body: status %d", rec.Code)
+	}
+
+	for i, share := range shares[:2] {
+		rec, status := submit(`{"share": "` + base64.RawURLEncoding.EncodeToString(share) + `"}`)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("share %d: status %d", i, rec.Code)
+		}
+		if status.Sealed != (i == 0) {
+			t.Fatalf("share %d: %+v", i, status)
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	u.ServeHTTP(rec, httptest.NewRequest(http.MethodDelete, "/unseal", nil))
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("DELETE: status %d", rec.Code)
+	}
+}
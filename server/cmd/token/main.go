@@ -0,0 +1,37 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/fromscript/hush/internal/auth"
+	"github.com/joho/godotenv"
+)
+
+func main() {
+	room := flag.String("room", "", "restrict the token to this room ID")
+	subject := flag.String("sub", "", "optional subject recorded in the token")
+	ttl := flag.Duration("ttl", time.Hour, "how long the token stays valid")
+	flag.Parse()
+
+	// Load environment variables from .env if it exists
+	err := godotenv.Load()
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		log.Fatalf("Error loading .env file: %v", err)
+	}
+
+	signer, err := auth.NewSigner([]byte(os.Getenv("JWT_SECRET")), auth.Audience())
+	if err != nil {
+		log.Fatalf("Invalid JWT_SECRET: %v", err)
+	}
+
+	token, err := signer.Issue(*subject, *room, *ttl)
+	if err != nil {
+		log.Fatalf("Failed to issue token: %v", err)
+	}
+	fmt.Println(token)
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/fromscript/hush/internal/crypto"
+)
+
+const usage = `usage:
+  unseal split [-n shares] [-m threshold] [-stdin]  split a new master key, or a base64 one from stdin
+  unseal submit [-addr host:port]                   submit a share read from stdin
+  unseal status [-addr host:port]                   show how many shares were received`
+
+func main() {
+	log.SetFlags(0)
+	if len(os.Args) < 2 {
+		log.Fatal(usage)
+	}
+
+	switch os.Args[1] {
+	case "split":
+		flags := flag.NewFlagSet("split", flag.ExitOnError)
+		n := flags.Int("n", 5, "number of shares")
+		m := flags.Int("m", 3, "shares needed to unseal")
+		stdin := flags.Bool("stdin", false, "split the base64 key read from stdin instead of a new one")
+		flags.Parse(os.Args[2:])
+		split(*n, *m, *stdin)
+	case "submit", "status":
+		flags := flag.NewFlagSet(os.Args[1], flag.ExitOnError)
+		addr := flags.String("addr", "127.0.0.1:8081", "unseal endpoint address")
+		flags.Parse(os.Args[2:])
+		url := "http://" + *addr + "/unseal"
+		if os.Args[1] == "submit" {
+			submit(url)
+		} else {
+			status(url)
+		}
+	default:
+		log.Fatal(usage)
+	}
+}
+
+func split(n, m int, stdin bool) {
+	var (
+		key []byte
+		err error
+	)
+	if stdin {
+		key, err = base64.StdEncoding.DecodeString(readLine())
+	} else {
+		key, err = crypto.GenerateMasterKey()
+	}
+	if err != nil {
+		log.Fatalf("Invalid key: %v", err)
+	}
+	if len(key) != crypto.KeySize {
+		log.Fatalf("Key must be %d bytes, got %d", crypto.KeySize, len(key))
+	}
+
+	shares, err := crypto.SplitSecret(key, n, m)
+	if err != nil {
+		log.Fatalf("Failed to split key: %v", err)
+	}
+	fmt.Printf("UNSEAL_THRESHOLD=%d\nUNSEAL_KEY_CHECK=%s\n\n", m, crypto.KeyCheck(key))
+	for i, share := range shares {
+		fmt.Printf("share %d: %s\n", i+1, base64.RawURLEncoding.EncodeToString(share))
+	}
+}
+
+// submit reads the share from stdin so it stays out of shell history.
+func submit(url string) {
+	fmt.Fprint(os.Stderr, "share: ")
+	body, err := json.Marshal(map[string]string{"share": readLine()})
+	if err != nil {
+		log.Fatal(err)
+	}
+	resp, err := http.Post(url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		log.Fatalf("Failed to submit share: %v", err)
+	}
+	printResponse(resp)
+}
+
+func status(url string) {
+	resp, err := http.Get(url)
+	if err != nil {
+		log.Fatalf("Failed to query status: %v", err)
+	}
+	printResponse(resp)
+}
+
+func printResponse(resp *http.Response) {
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Print(string(body))
+	if resp.StatusCode != http.StatusOK {
+		os.Exit(1)
+	}
+}
+
+func readLine() string {
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && err != io.EOF {
+		log.Fatal(err)
+	}
+	return strings.TrimSpace(line)
+}
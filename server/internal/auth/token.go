@@ -0,0 +1,116 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	DefaultAudience = "hush"
+
+	minSecretSize = 32
+)
+
+var (
+	ErrMalformedToken   = errors.New("malformed token")
+	ErrInvalidSignature = errors.New("invalid token signature")
+	ErrTokenExpired     = errors.New("token expired")
+	ErrWrongAudience    = errors.New("token issued for another audience")
+)
+
+// Claims is the payload of a connection token. A token with a Room may only
+// be used to join that room.
+type Claims struct {
+	Subject  string `json:"sub,omitempty"`
+	Audience string `json:"aud"`
+	Room     string `json:"room,omitempty"`
+	IssuedAt int64  `json:"iat"`
+	Expiry   int64  `json:"exp"`
+}
+
+// Signer issues and verifies HS256 JSON Web Tokens for one audience.
+type Signer struct {
+	secret   []byte
+	audience string
+}
+
+// tokenHeader is the fixed JWT header of every token, pre-encoded.
+var tokenHeader = base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"HS256","typ":"JWT"}`))
+
+// Audience returns the token audience configured in JWT_AUDIENCE, or
+// DefaultAudience. Both the issuer and the server read it from here.
+func Audience() string {
+	if aud := os.Getenv("JWT_AUDIENCE"); aud != "" {
+		return aud
+	}
+	return DefaultAudience
+}
+
+func NewSigner(secret []byte, audience string) (*Signer, error) {
+	if len(secret) < minSecretSize {
+		return nil, fmt.Errorf("token secret must be at least %d bytes, got %d", minSecretSize, len(secret))
+	}
+	return &Signer{secret: secret, audience: audience}, nil
+}
+
+func (s *Signer) Issue(subject, room string, ttl time.Duration) (string, error) {
+	now := time.Now()
+	payload, err := json.Marshal(Claims{
+		Subject:  subject,
+		Audience: s.audience,
+		Room:     room,
+		IssuedAt: now.Unix(),
+		Expiry:   now.Add(ttl).Unix(),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	signingInput := tokenHeader + "." + base64.RawURLEncoding.EncodeToString(payload)
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(s.sign(signingInput)), nil
+}
+
+func (s *Signer) Verify(token string) (*Claims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 || parts[0] != tokenHeader {
+		return nil, ErrMalformedToken
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, ErrMalformedToken
+	}
+	if !hmac.Equal(signature, s.sign(parts[0]+"."+parts[1])) {
+		return nil, ErrInvalidSignature
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, ErrMalformedToken
+	}
+	var claims Claims
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return nil, ErrMalformedToken
+	}
+
+	if claims.Audience != s.audience {
+		return nil, ErrWrongAudience
+	}
+	if time.Now().Unix() >= claims.Expiry {
+		return nil, ErrTokenExpired
+	}
+	return &claims, nil
+}
+
+func (s *Signer) sign(signingInput string) []byte {
+	mac := hmac.New(sha256.New, s.secret)
+	mac.Write([]byte(signingInput))
+	return mac.Sum(nil)
+}
@@ -0,0 +1,147 @@
+package auth
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+var testSecret = []byte(strings.Repeat("s", minSecretSize))
+
+func newTestSigner(t *testing.T, secret []byte) *Signer {
+	t.Helper()
+	signer, err := NewSigner(secret, DefaultAudience)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signer
+}
+
+func TestVerifyRoundTrip(t *testing.T) {
+	signer := newTestSigner(t, testSecret)
+	token, err := signer.Issue("alice", "room", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	claims, err := signer.Verify(token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claims.Subject != "alice" || claims.Room != "room" || claims.Audience != DefaultAudience {
+		t.Errorf("claims: %+v", claims)
+	}
+}
+
+func TestNewSignerRejectsShortSecret(t *testing.T) {
+	if _, err := NewSigner(testSecret[:minSecretSize-1], DefaultAudience); err == nil {
+		t.Error("expected an error")
+	}
+}
+
+func TestVerifyRejectsWrongKey(t *testing.T) {
+	token, err := newTestSigner(t, testSecret).Issue("alice", "", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other := newTestSigner(t, []byte(strings.Repeat("o", minSecretSize)))
+	if _, err := other.Verify(token); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("got %v, want ErrInvalidSignature", err)
+	}
+}
+
+func TestVerifyRejectsTamperedClaims(t *testing.T) {
+	signer := newTestSigner(t, testSecret)
+	token, err := signer.Issue("alice", "room", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	parts := strings.Split(token, ".")
+	payload, _ := json.Marshal(Claims{Subject: "alice", Audience: DefaultAudience, Expiry: time.Now().Add(time.Hour).Unix()})
+	parts[1] = base64.RawURLEncoding.EncodeToString(payload)
+	if _, err := signer.Verify(strings.Join(parts, ".")); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("widened room: got %v, want ErrInvalidSignature", err)
+	}
+
+	parts = strings.Split(token, ".")
+	signature, _ := base64.RawURLEncoding.DecodeString(parts[2])
+	signature[0] ^= 1
+	parts[2] = base64.RawURLEncoding.EncodeToString(signature)
+	if _, err := signer.Verify(strings.Join(parts, ".")); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("changed signature: got %v, want ErrInvalidSignature", err)
+	}
+}
+
+func TestVerifyRejectsExpiredToken(t *testing.T) {
+	signer := newTestSigner(t, testSecret)
+	token, err := signer.Issue("alice", "", -time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := signer.Verify(token); !errors.Is(err, ErrTokenExpired) {
+		t.Errorf("got %v, want ErrTokenExpired", err)
+	}
+}
+
+func TestVerifyRejectsOtherAudience(t *testing.T) {
+	other, err := NewSigner(testSecret, "other")
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, err := other.Issue("alice", "", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := newTestSigner(t, testSecret).Verify(token); !errors.Is(err, ErrWrongAudience) {
+		t.Errorf("got %v, want ErrWrongAudience", err)
+	}
+}
+
+func TestAudience(t *testing.T) {
+	t.Setenv("JWT_AUDIENCE", "")
+	if aud := Audience(); aud != DefaultAudience {
+		t.Errorf("got %q, want %q", aud, DefaultAudience)
+	}
+	t.Setenv("JWT_AUDIENCE", "staging")
+	if aud := Audience(); aud != "staging" {
+		t.Errorf("got %q, want staging", aud)
+	}
+}
+
+func TestVerifyRejectsOtherAlgorithms(t *testing.T) {
+	signer := newTestSigner(t, testSecret)
+	token, err := signer.Issue("alice", "", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	parts := strings.Split(token, ".")
+
+	for _, header := range []string{
+		`{"alg":"none","typ":"JWT"}`,
+		`{"alg":"HS512","typ":"JWT"}`,
+		`{"alg":"RS256","typ":"JWT"}`,
+		`{"typ":"JWT","alg":"HS256"}`,
+	} {
+		encoded := base64.RawURLEncoding.EncodeToString([]byte(header))
+		signingInput := encoded + "." + parts[1]
+		// Signed correctly with the shared secret, only the header differs
+		forged := signingInput + "." + base64.RawURLEncoding.EncodeToString(signer.sign(signingInput))
+		if _, err := signer.Verify(forged); !errors.Is(err, ErrMalformedToken) {
+			t.Errorf("header %s: got %v, want ErrMalformedToken", header, err)
+		}
+		if _, err := signer.Verify(encoded + "." + parts[1] + "."); !errors.Is(err, ErrMalformedToken) {
+			t.Errorf("unsigned %s: got %v, want ErrMalformedToken", header, err)
+		}
+	}
+}
+
+func TestVerifyRejectsMalformedTokens(t *testing.T) {
+	signer := newTestSigner(t, testSecret)
+	for _, token := range []string{"", "a.b", "a.b.c.d", tokenHeader + ".e30.!!!"} {
+		if _, err := signer.Verify(token); !errors.Is(err, ErrMalformedToken) {
+			t.Errorf("%q: got %v, want ErrMalformedToken", token, err)
+		}
+	}
+}
@@ -0,0 +1,22 @@
+package cluster
+
+import "context"
+
+// Notification is a payload published to a room by some replica.
+type Notification struct {
+	RoomID  string
+	Payload []byte
+}
+
+// Bus relays room traffic between hush replicas. A replica subscribes to the
+// rooms it has local members in and receives everything published to them,
+// including its own publications.
+type Bus interface {
+	Publish(ctx context.Context, roomID string, payload []byte) error
+	Subscribe(roomID string) error
+	Unsubscribe(roomID string) error
+	Notifications() <-chan Notification
+	// MaxPayload is the largest payload Publish accepts.
+	MaxPayload() int
+	Close() error
+}
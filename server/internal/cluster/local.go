@@ -0,0 +1,23 @@
+package cluster
+
+import "context"
+
+// LocalBus is the Bus of a single replica: there is nobody to relay to.
+type LocalBus struct{}
+
+func NewLocalBus() *LocalBus {
+	return &LocalBus{}
+}
+
+func (lb *LocalBus) Publish(context.Context, string, []byte) error { return nil }
+
+func (lb *LocalBus) Subscribe(string) error { return nil }
+
+func (lb *LocalBus) Unsubscribe(string) error { return nil }
+
+// Notifications returns a nil channel, which never delivers.
+func (lb *LocalBus) Notifications() <-chan Notification { return nil }
+
+func (lb *LocalBus) MaxPayload() int { return int(^uint(0) >> 1) }
+
+func (lb *LocalBus) Close() error { return nil }
@@ -0,0 +1,139 @@
+package cluster
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+const (
+	// Postgres rejects NOTIFY payloads of 8000 bytes or more
+	maxNotifyPayload = 7999
+
+	channelPrefix = "hush_room_"
+
+	minReconnectInterval = time.Second
+	maxReconnectInterval = time.Minute
+)
+
+// PostgresBus relays room traffic through Postgres LISTEN/NOTIFY, using one
+// channel per room. Payloads are sent as is and must therefore be text, such
+// as JSON.
+type PostgresBus struct {
+	db            *sql.DB
+	listener      *pq.Listener
+	notifications chan Notification
+	done          chan struct{}
+
+	mu       sync.RWMutex
+	channels map[string]string // channel -> roomID
+}
+
+func NewPostgresBus(db *sql.DB, dsn string) *PostgresBus {
+	pb := &PostgresBus{
+		db:            db,
+		notifications: make(chan Notification, 1024),
+		done:          make(chan struct{}),
+		channels:      make(map[string]string),
+	}
+	pb.listener = pq.NewListener(dsn, minReconnectInterval, maxReconnectInterval, func(event pq.ListenerEventType, err error) {
+		if err != nil {
+			slog.Warn("Cluster listener event", "event", event, "error", err)
+		}
+	})
+	go pb.relay()
+	return pb
+}
+
+func (pb *PostgresBus) Publish(ctx context.Context, roomID string, payload []byte) error {
+	if len(payload) > maxNotifyPayload {
+		return fmt.Errorf("payload of %d bytes exceeds notify limit", len(payload))
+	}
+	_, err := pb.db.ExecContext(ctx, "SELECT pg_notify($1, $2)", channelName(roomID), string(payload))
+	return err
+}
+
+func (pb *PostgresBus) Subscribe(roomID string) error {
+	channel := channelName(roomID)
+	pb.mu.Lock()
+	pb.channels[channel] = roomID
+	pb.mu.Unlock()
+
+	err := pb.listener.Listen(channel)
+	if errors.Is(err, pq.ErrChannelAlreadyOpen) {
+		return nil
+	}
+	return err
+}
+
+func (pb *PostgresBus) Unsubscribe(roomID string) error {
+	channel := channelName(roomID)
+	pb.mu.Lock()
+	delete(pb.channels, channel)
+	pb.mu.Unlock()
+
+	err := pb.listener.Unlisten(channel)
+	if errors.Is(err, pq.ErrChannelNotOpen) {
+		return nil
+	}
+	return err
+}
+
+func (pb *PostgresBus) Notifications() <-chan Notification {
+	return pb.notifications
+}
+
+func (pb *PostgresBus) MaxPayload() int {
+	return maxNotifyPayload
+}
+
+func (pb *PostgresBus) Close() error {
+	close(pb.done)
+	return pb.listener.Close()
+}
+
+func (pb *PostgresBus) relay() {
+	for {
+		select {
+		case n, ok := <-pb.listener.Notify:
+			if !ok {
+				return
+			}
+			// A nil notification means the connection was re-established and
+			// notifications may have been missed
+			if n == nil {
+				slog.Warn("Cluster listener reconnected, notifications may have been lost")
+				continue
+			}
+			pb.mu.RLock()
+			roomID, ok := pb.channels[n.Channel]
+			pb.mu.RUnlock()
+			if !ok {
+				continue
+			}
+			notification := Notification{RoomID: roomID, Payload: []byte(n.Extra)}
+			select {
+			case pb.notifications <- notification:
+			default:
+				slog.Warn("Cluster notification buffer full", "room", notification.RoomID)
+			}
+		case <-pb.done:
+			return
+		}
+	}
+}
+
+// channelName maps a room ID, which may be any string, to a valid channel
+// identifier well below the 63 byte limit.
+func channelName(roomID string) string {
+	sum := sha256.Sum256([]byte(roomID))
+	return channelPrefix + hex.EncodeToString(sum[:16])
+}
@@ -4,12 +4,30 @@ import (
 	"crypto/aes"
 	"crypto/cipher"
 	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
 	"io"
 )
 
+const (
+	KeySize = 32
+
+	// envelopeVersion is the first byte of every envelope produced by Seal
+	envelopeVersion    = 0x01
+	envelopeHeaderSize = 1 + 4 // version, key ID
+)
+
+var (
+	ErrDecrypt            = errors.New("message authentication failed")
+	ErrShortCiphertext    = errors.New("ciphertext too short")
+	ErrUnsupportedVersion = errors.New("unsupported envelope version")
+	ErrUnknownKey         = errors.New("envelope encrypted with an unknown key")
+)
+
 // // GenerateKey creates a 32-byte AES key
 func GenerateMasterKey() ([]byte, error) {
-	key := make([]byte, 32)
+	key := make([]byte, KeySize)
 	if _, err := rand.Read(key); err != nil {
 		return nil, err
 	}
@@ -18,18 +36,117 @@ func GenerateMasterKey() ([]byte, error) {
 
 // Encrypt data using AES-GCM
 func Encrypt(data []byte, key []byte) ([]byte, error) {
-	block, _ := aes.NewCipher(key)
-	gcm, _ := cipher.NewGCM(block)
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
 	nonce := make([]byte, gcm.NonceSize())
-	io.ReadFull(rand.Reader, nonce)
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
 	return gcm.Seal(nonce, nonce, data, nil), nil
 }
 
 // Decrypt data using AES-GCM
 func Decrypt(encrypted []byte, key []byte) ([]byte, error) {
-	block, _ := aes.NewCipher(key)
-	gcm, _ := cipher.NewGCM(block)
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
 	nonceSize := gcm.NonceSize()
+	if len(encrypted) < nonceSize+gcm.Overhead() {
+		return nil, ErrShortCiphertext
+	}
 	nonce, ciphertext := encrypted[:nonceSize], encrypted[nonceSize:]
-	return gcm.Open(nil, nonce, ciphertext, nil)
+	plaintext, err := gcm.Open(nil, nonce, ciphertext, nil)
+	if err != nil {
+		return nil, ErrDecrypt
+	}
+	return plaintext, nil
+}
+
+// Seal encrypts plaintext into a self-describing envelope:
+//
+//	version (1) | key ID (4, big endian) | nonce (12) | ciphertext and tag
+//
+// The header is authenticated along with ad, so neither the key ID nor the
+// context the caller binds the data to can be swapped.
+func Seal(key Key, plaintext, ad []byte) ([]byte, error) {
+	gcm, err := newGCM(key.Material)
+	if err != nil {
+		return nil, err
+	}
+
+	envelope := make([]byte, envelopeHeaderSize+gcm.NonceSize(), envelopeHeaderSize+gcm.NonceSize()+len(plaintext)+gcm.Overhead())
+	envelope[0] = envelopeVersion
+	binary.BigEndian.PutUint32(envelope[1:envelopeHeaderSize], key.ID)
+	nonce := envelope[envelopeHeaderSize:]
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+
+	return gcm.Seal(envelope, nonce, plaintext, envelopeAD(envelope[:envelopeHeaderSize], ad)), nil
+}
+
+// Open decrypts an envelope produced by Seal with the key it names, which
+// must be in keys. ad must match what was passed to Seal.
+func Open(keys *Keyring, envelope, ad []byte) ([]byte, error) {
+	keyID, err := EnvelopeKeyID(envelope)
+	if err != nil {
+		return nil, err
+	}
+	key, ok := keys.Key(keyID)
+	if !ok {
+		return nil, fmt.Errorf("%w: %d", ErrUnknownKey, keyID)
+	}
+	gcm, err := newGCM(key.Material)
+	if err != nil {
+		return nil, err
+	}
+
+	body := envelope[envelopeHeaderSize:]
+	if len(body) < gcm.NonceSize()+gcm.Overhead() {
+		return nil, ErrShortCiphertext
+	}
+	nonce, ciphertext := body[:gcm.NonceSize()], body[gcm.NonceSize():]
+	plaintext, err := gcm.Open(nil, nonce, ciphertext, envelopeAD(envelope[:envelopeHeaderSize], ad))
+	if err != nil {
+		return nil, ErrDecrypt
+	}
+	return plaintext, nil
+}
+
+// EnvelopeKeyID returns the ID of the key an envelope was sealed with.
+func EnvelopeKeyID(envelope []byte) (uint32, error) {
+	if len(envelope) < envelopeHeaderSize {
+		return 0, ErrShortCiphertext
+	}
+	if envelope[0] != envelopeVersion {
+		return 0, fmt.Errorf("%w: %d", ErrUnsupportedVersion, envelope[0])
+	}
+	return binary.BigEndian.Uint32(envelope[1:envelopeHeaderSize]), nil
+}
+
+// MessageAD binds a stored message to its room and ID. Both parts are length
+// prefixed so that no two different pairs produce the same bytes.
+func MessageAD(roomID, messageID string) []byte {
+	ad := make([]byte, 0, 8+len(roomID)+len(messageID))
+	ad = binary.BigEndian.AppendUint32(ad, uint32(len(roomID)))
+	ad = append(ad, roomID...)
+	ad = binary.BigEndian.AppendUint32(ad, uint32(len(messageID)))
+	return append(ad, messageID...)
+}
+
+func envelopeAD(header, ad []byte) []byte {
+	full := make([]byte, 0, len(header)+len(ad))
+	full = append(full, header...)
+	return append(full, ad...)
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
 }
@@ -0,0 +1,151 @@
+package crypto
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func testKeyring(t *testing.T, keys ...Key) *Keyring {
+	t.Helper()
+	kr, err := NewKeyring(keys[0], keys[1:]...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return kr
+}
+
+func testKey(t *testing.T, id uint32) Key {
+	t.Helper()
+	material, err := GenerateMasterKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return Key{ID: id, Material: material}
+}
+
+func TestEncryptRoundTrip(t *testing.T) {
+	key, _ := GenerateMasterKey()
+	ciphertext, err := Encrypt([]byte("hello"), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	plaintext, err := Decrypt(ciphertext, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(plaintext) != "hello" {
+		t.Errorf("got %q", plaintext)
+	}
+
+	other, _ := GenerateMasterKey()
+	if _, err := Decrypt(ciphertext, other); !errors.Is(err, ErrDecrypt) {
+		t.Errorf("wrong key: got %v, want ErrDecrypt", err)
+	}
+	ciphertext[len(ciphertext)-1] ^= 1
+	if _, err := Decrypt(ciphertext, key); !errors.Is(err, ErrDecrypt) {
+		t.Errorf("tampered: got %v, want ErrDecrypt", err)
+	}
+	if _, err := Decrypt(ciphertext[:10], key); !errors.Is(err, ErrShortCiphertext) {
+		t.Errorf("short: got %v, want ErrShortCiphertext", err)
+	}
+}
+
+func TestSealOpenRoundTrip(t *testing.T) {
+	key := testKey(t, 7)
+	ad := MessageAD("room", "message")
+	envelope, err := Seal(key, []byte("secret"), ad)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id, err := EnvelopeKeyID(envelope); err != nil || id != 7 {
+		t.Fatalf("key ID %d, %v", id, err)
+	}
+
+	plaintext, err := Open(testKeyring(t, testKey(t, 8), key), envelope, ad)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(plaintext) != "secret" {
+		t.Errorf("got %q", plaintext)
+	}
+}
+
+func TestOpenRejectsTampering(t *testing.T) {
+	key := testKey(t, 1)
+	keys := testKeyring(t, key)
+	ad := MessageAD("room", "message")
+	envelope, err := Seal(key, []byte("secret"), ad)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := range envelope {
+		tampered := bytes.Clone(envelope)
+		tampered[i] ^= 0x80
+		if _, err := Open(keys, tampered, ad); err == nil {
+			t.Errorf("byte %d flipped: envelope still opened", i)
+		}
+	}
+	if _, err := Open(keys, envelope[:len(envelope)-1], ad); !errors.Is(err, ErrDecrypt) {
+		t.Errorf("truncated: got %v, want ErrDecrypt", err)
+	}
+	if _, err := Open(keys, envelope[:envelopeHeaderSize+4], ad); !errors.Is(err, ErrShortCiphertext) {
+		t.Errorf("short: got %v, want ErrShortCiphertext", err)
+	}
+}
+
+func TestOpenRejectsWrongKey(t *testing.T) {
+	key := testKey(t, 1)
+	ad := MessageAD("room", "message")
+	envelope, err := Seal(key, []byte("secret"), ad)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := Open(testKeyring(t, testKey(t, 2)), envelope, ad); !errors.Is(err, ErrUnknownKey) {
+		t.Errorf("missing key: got %v, want ErrUnknownKey", err)
+	}
+	// Same ID, different material
+	if _, err := Open(testKeyring(t, testKey(t, 1)), envelope, ad); !errors.Is(err, ErrDecrypt) {
+		t.Errorf("wrong material: got %v, want ErrDecrypt", err)
+	}
+}
+
+func TestOpenRejectsOtherAssociatedData(t *testing.T) {
+	key := testKey(t, 1)
+	keys := testKeyring(t, key)
+	envelope, err := Seal(key, []byte("secret"), MessageAD("room", "message"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, ad := range [][]byte{
+		MessageAD("other", "message"),
+		MessageAD("room", "other"),
+		MessageAD("roomm", "essage"),
+		nil,
+	} {
+		if _, err := Open(keys, envelope, ad); !errors.Is(err, ErrDecrypt) {
+			t.Errorf("ad %x: got %v, want ErrDecrypt", ad, err)
+		}
+	}
+}
+
+func TestOpenRejectsUnknownVersion(t *testing.T) {
+	key := testKey(t, 1)
+	envelope, err := Seal(key, []byte("secret"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	envelope[0] = envelopeVersion + 1
+	if _, err := Open(testKeyring(t, key), envelope, nil); !errors.Is(err, ErrUnsupportedVersion) {
+		t.Errorf("got %v, want ErrUnsupportedVersion", err)
+	}
+}
+
+func TestMessageADIsUnambiguous(t *testing.T) {
+	if bytes.Equal(MessageAD("ab", "c"), MessageAD("a", "bc")) {
+		t.Error("different room and message IDs produced the same AD")
+	}
+}
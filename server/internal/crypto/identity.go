@@ -0,0 +1,99 @@
+package crypto
+
+import (
+	"crypto/ed25519"
+	"encoding/binary"
+	"errors"
+)
+
+// Identities are Ed25519 keys held by clients. The server only sees public
+// keys and identifies them by Fingerprint.
+
+const (
+	identityContext = "hush identity v1"
+	messageContext  = "hush message v2"
+	directContext   = "hush direct v1"
+	editContext     = "hush edit v1"
+)
+
+var (
+	ErrInvalidIdentityKey = errors.New("invalid Ed25519 public key")
+	ErrBadSignature       = errors.New("signature verification failed")
+)
+
+func ParseIdentityKey(b []byte) (ed25519.PublicKey, error) {
+	if len(b) != ed25519.PublicKeySize {
+		return nil, ErrInvalidIdentityKey
+	}
+	return ed25519.PublicKey(b), nil
+}
+
+// IdentityProof is what a client signs to register its identity key with a
+// session, proving it holds the private key.
+func IdentityProof(sessionID string, challenge []byte) []byte {
+	return signingInput(identityContext, []byte(sessionID), challenge)
+}
+
+// MessageSigningInput is what a client signs for every room message. It
+// covers everything the recipients act on, bound to the room, including
+// where in a thread the message goes.
+func MessageSigningInput(roomID string, epoch uint64, ttl int64, replyTo, threadID string, payload []byte) []byte {
+	return signingInput(messageContext,
+		[]byte(roomID),
+		binary.BigEndian.AppendUint64(nil, epoch),
+		binary.BigEndian.AppendUint64(nil, uint64(ttl)),
+		[]byte(replyTo),
+		[]byte(threadID),
+		payload,
+	)
+}
+
+// DirectSigningInput is what a client signs for a direct message, bound to
+// its recipient handle or fingerprint.
+func DirectSigningInput(to string, ttl int64, payload []byte) []byte {
+	return signingInput(directContext,
+		[]byte(to),
+		binary.BigEndian.AppendUint64(nil, uint64(ttl)),
+		payload,
+	)
+}
+
+// EditSigningInput is what a client signs to replace the payload of one of
+// its room messages.
+func EditSigningInput(roomID, messageID string, epoch uint64, payload []byte) []byte {
+	return signingInput(editContext,
+		[]byte(roomID),
+		[]byte(messageID),
+		binary.BigEndian.AppendUint64(nil, epoch),
+		payload,
+	)
+}
+
+func SignMessage(key ed25519.PrivateKey, roomID string, epoch uint64, ttl int64, replyTo, threadID string, payload []byte) []byte {
+	return ed25519.Sign(key, MessageSigningInput(roomID, epoch, ttl, replyTo, threadID, payload))
+}
+
+func SignDirect(key ed25519.PrivateKey, to string, ttl int64, payload []byte) []byte {
+	return ed25519.Sign(key, DirectSigningInput(to, ttl, payload))
+}
+
+func SignEdit(key ed25519.PrivateKey, roomID, messageID string, epoch uint64, payload []byte) []byte {
+	return ed25519.Sign(key, EditSigningInput(roomID, messageID, epoch, payload))
+}
+
+func Verify(publicKey ed25519.PublicKey, input, signature []byte) error {
+	if len(signature) != ed25519.SignatureSize || !ed25519.Verify(publicKey, input, signature) {
+		return ErrBadSignature
+	}
+	return nil
+}
+
+// signingInput length-prefixes every part, so no two inputs collide.
+func signingInput(context string, parts ...[]byte) []byte {
+	input := []byte(context)
+	for _, part := range parts {
+		input = binary.BigEndian.AppendUint32(input, uint32(len(part)))
+		input = append(input, part...)
+	}
+	return input
+}
@@ -0,0 +1,144 @@
+package crypto
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/joho/godotenv"
+)
+
+// Key versions are configured as MASTER_KEY_<id>=<base64 key>, with
+// MASTER_KEY_ACTIVE naming the version new data is sealed with. A single
+// MASTER_KEY is accepted as version 1.
+const (
+	keyVarPrefix = "MASTER_KEY_"
+	activeKeyVar = "MASTER_KEY_ACTIVE"
+	legacyKeyVar = "MASTER_KEY"
+	legacyKeyID  = 1
+	keysFileVar  = "MASTER_KEYS_FILE"
+	kmsFileVar   = "KMS_KEY_FILE"
+	kmsPassVar   = "KMS_PASSPHRASE"
+)
+
+var ErrNoMasterKey = errors.New("no master key configured")
+
+// LoadKeyring reads key versions from the file named by MASTER_KEYS_FILE, or
+// from the environment when it is unset.
+func LoadKeyring() (*Keyring, error) {
+	if path := os.Getenv(keysFileVar); path != "" {
+		return LoadKeyringFile(path)
+	}
+
+	vars := make(map[string]string)
+	for _, kv := range os.Environ() {
+		if name, value, ok := strings.Cut(kv, "="); ok {
+			vars[name] = value
+		}
+	}
+	return ParseKeyring(vars)
+}
+
+// LoadKeyProvider wraps room keys with a passphrase-sealed key file when
+// KMS_KEY_FILE is set, and with the master keyring otherwise. The master
+// keyring, if any, is also returned to read data sealed before room keys
+// existed.
+func LoadKeyProvider() (KeyProvider, *Keyring, error) {
+	masterKeys, err := LoadKeyring()
+	if err != nil && !errors.Is(err, ErrNoMasterKey) {
+		return nil, nil, fmt.Errorf("load master keys: %w", err)
+	}
+
+	if path := os.Getenv(kmsFileVar); path != "" {
+		kms, err := OpenLocalKMS(path, []byte(os.Getenv(kmsPassVar)))
+		if err != nil {
+			return nil, nil, fmt.Errorf("open %s: %w", path, err)
+		}
+		return kms, masterKeys, nil
+	}
+
+	if masterKeys == nil {
+		return nil, nil, ErrNoMasterKey
+	}
+	return NewKeyringProvider(masterKeys), masterKeys, nil
+}
+
+// LoadKeyringFile reads key versions from a file in .env format.
+func LoadKeyringFile(path string) (*Keyring, error) {
+	vars, err := godotenv.Read(path)
+	if err != nil {
+		return nil, fmt.Errorf("read %s: %w", path, err)
+	}
+	return ParseKeyring(vars)
+}
+
+func ParseKeyring(vars map[string]string) (*Keyring, error) {
+	var keys []Key
+	for name, value := range vars {
+		if name == activeKeyVar || !strings.HasPrefix(name, keyVarPrefix) {
+			continue
+		}
+		id, err := strconv.ParseUint(strings.TrimPrefix(name, keyVarPrefix), 10, 32)
+		if err != nil {
+			continue
+		}
+		if id == RoomKeyID {
+			return nil, fmt.Errorf("%s: key ID %d is reserved for room keys", name, RoomKeyID)
+		}
+		material, err := base64.StdEncoding.DecodeString(value)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		keys = append(keys, Key{ID: uint32(id), Material: material})
+	}
+
+	if len(keys) == 0 {
+		value, ok := vars[legacyKeyVar]
+		if !ok || value == "" {
+			return nil, ErrNoMasterKey
+		}
+		material, err := base64.StdEncoding.DecodeString(value)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", legacyKeyVar, err)
+		}
+		return NewKeyring(Key{ID: legacyKeyID, Material: material})
+	}
+
+	active, err := activeKeyID(vars, keys)
+	if err != nil {
+		return nil, err
+	}
+	var others []Key
+	var activeKey Key
+	for _, key := range keys {
+		if key.ID == active {
+			activeKey = key
+		} else {
+			others = append(others, key)
+		}
+	}
+	if activeKey.Material == nil {
+		return nil, fmt.Errorf("%s names unknown key %d", activeKeyVar, active)
+	}
+	return NewKeyring(activeKey, others...)
+}
+
+// activeKeyID defaults to the highest configured version.
+func activeKeyID(vars map[string]string, keys []Key) (uint32, error) {
+	if value, ok := vars[activeKeyVar]; ok && value != "" {
+		id, err := strconv.ParseUint(value, 10, 32)
+		if err != nil {
+			return 0, fmt.Errorf("%s: %w", activeKeyVar, err)
+		}
+		return uint32(id), nil
+	}
+
+	var highest uint32
+	for _, key := range keys {
+		highest = max(highest, key.ID)
+	}
+	return highest, nil
+}
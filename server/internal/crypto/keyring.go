@@ -0,0 +1,40 @@
+package crypto
+
+import "fmt"
+
+// Key is one version of a symmetric key. IDs are recorded in every envelope,
+// so old versions stay usable for decryption after rotation.
+type Key struct {
+	ID       uint32
+	Material []byte
+}
+
+// Keyring holds every known key version. New data is sealed with the active
+// key; the others are only used to open existing envelopes.
+type Keyring struct {
+	active uint32
+	keys   map[uint32]Key
+}
+
+func NewKeyring(active Key, others ...Key) (*Keyring, error) {
+	kr := &Keyring{active: active.ID, keys: make(map[uint32]Key, len(others)+1)}
+	for _, key := range append([]Key{active}, others...) {
+		if len(key.Material) != KeySize {
+			return nil, fmt.Errorf("key %d must be %d bytes, got %d", key.ID, KeySize, len(key.Material))
+		}
+		if _, dup := kr.keys[key.ID]; dup {
+			return nil, fmt.Errorf("duplicate key ID %d", key.ID)
+		}
+		kr.keys[key.ID] = key
+	}
+	return kr, nil
+}
+
+func (kr *Keyring) Active() Key {
+	return kr.keys[kr.active]
+}
+
+func (kr *Keyring) Key(id uint32) (Key, bool) {
+	key, ok := kr.keys[id]
+	return key, ok
+}
@@ -0,0 +1,184 @@
+package crypto
+
+import (
+	"context"
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+)
+
+// RoomKeyID is the key ID recorded in envelopes sealed with a room data key.
+// Master key versions start at 1.
+const RoomKeyID = 0
+
+// KeyProvider wraps data keys with a key-encryption key it never hands out.
+// ad binds a wrapped key to its owner and must match on unwrap.
+type KeyProvider interface {
+	WrapKey(ctx context.Context, dek, ad []byte) ([]byte, error)
+	UnwrapKey(ctx context.Context, wrapped, ad []byte) ([]byte, error)
+}
+
+// GenerateDataKey creates a random data key for Seal.
+func GenerateDataKey() (Key, error) {
+	material, err := GenerateMasterKey()
+	if err != nil {
+		return Key{}, err
+	}
+	return Key{ID: RoomKeyID, Material: material}, nil
+}
+
+// RoomKeyAD binds a wrapped data key to its room.
+func RoomKeyAD(roomID string) []byte {
+	return append([]byte("room:"), roomID...)
+}
+
+// IdentityKeyAD binds a wrapped data key to the identity whose direct
+// messages it seals.
+func IdentityKeyAD(fingerprint string) []byte {
+	return append([]byte("identity:"), fingerprint...)
+}
+
+// KeyringProvider wraps data keys with the active key of a keyring and
+// unwraps with any version in it.
+type KeyringProvider struct {
+	keys *Keyring
+}
+
+func NewKeyringProvider(keys *Keyring) *KeyringProvider {
+	return &KeyringProvider{keys: keys}
+}
+
+func (kp *KeyringProvider) WrapKey(_ context.Context, dek, ad []byte) ([]byte, error) {
+	return Seal(kp.keys.Active(), dek, ad)
+}
+
+func (kp *KeyringProvider) UnwrapKey(_ context.Context, wrapped, ad []byte) ([]byte, error) {
+	return Open(kp.keys, wrapped, ad)
+}
+
+const (
+	localKMSVersion = 1
+	// OWASP's 2023 recommendation for PBKDF2-HMAC-SHA256. scrypt and argon2
+	// live in golang.org/x/crypto, which this module does not depend on.
+	localKMSIterations = 600_000
+	localKMSSaltSize   = 16
+)
+
+var localKMSAD = []byte("hush local kms v1")
+
+var ErrWrongPassphrase = errors.New("wrong passphrase for key file")
+
+// localKMSFile is the on-disk form of a LocalKMS. The key-encryption key is
+// sealed with a key derived from the operator's passphrase.
+type localKMSFile struct {
+	Version    int    `json:"version"`
+	KDF        string `json:"kdf"`
+	Iterations int    `json:"iterations"`
+	Salt       []byte `json:"salt"`
+	Key        []byte `json:"key"`
+}
+
+// LocalKMS keeps its key-encryption key in a passphrase-sealed file.
+type LocalKMS struct {
+	*KeyringProvider
+}
+
+// OpenLocalKMS unseals the key file at path, creating it with a fresh
+// key-encryption key if it does not exist yet.
+func OpenLocalKMS(path string, passphrase []byte) (*LocalKMS, error) {
+	if len(passphrase) == 0 {
+		return nil, errors.New("empty key file passphrase")
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return createLocalKMS(path, passphrase)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var file localKMSFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+	if file.Version != localKMSVersion || file.KDF != "pbkdf2-sha256" {
+		return nil, fmt.Errorf("%w: %d/%s", ErrUnsupportedVersion, file.Version, file.KDF)
+	}
+
+	wrapping, err := passphraseKeyring(passphrase, file.Salt, file.Iterations)
+	if err != nil {
+		return nil, err
+	}
+	kek, err := Open(wrapping, file.Key, localKMSAD)
+	if errors.Is(err, ErrDecrypt) {
+		return nil, ErrWrongPassphrase
+	}
+	if err != nil {
+		return nil, err
+	}
+	return newLocalKMS(kek)
+}
+
+func createLocalKMS(path string, passphrase []byte) (*LocalKMS, error) {
+	kek, err := GenerateMasterKey()
+	if err != nil {
+		return nil, err
+	}
+	salt := make([]byte, localKMSSaltSize)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+
+	wrapping, err := passphraseKeyring(passphrase, salt, localKMSIterations)
+	if err != nil {
+		return nil, err
+	}
+	sealed, err := Seal(wrapping.Active(), kek, localKMSAD)
+	if err != nil {
+		return nil, err
+	}
+	data, err := json.MarshalIndent(localKMSFile{
+		Version:    localKMSVersion,
+		KDF:        "pbkdf2-sha256",
+		Iterations: localKMSIterations,
+		Salt:       salt,
+		Key:        sealed,
+	}, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	// O_EXCL so two replicas starting together cannot overwrite each other
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return nil, err
+	}
+	if err := f.Close(); err != nil {
+		return nil, err
+	}
+	return newLocalKMS(kek)
+}
+
+func newLocalKMS(kek []byte) (*LocalKMS, error) {
+	keys, err := NewKeyring(Key{ID: 1, Material: kek})
+	if err != nil {
+		return nil, err
+	}
+	return &LocalKMS{KeyringProvider: NewKeyringProvider(keys)}, nil
+}
+
+func passphraseKeyring(passphrase, salt []byte, iterations int) (*Keyring, error) {
+	derived, err := pbkdf2.Key(sha256.New, string(passphrase), salt, iterations, KeySize)
+	if err != nil {
+		return nil, err
+	}
+	return NewKeyring(Key{ID: 1, Material: derived})
+}
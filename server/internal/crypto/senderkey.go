@@ -0,0 +1,180 @@
+package crypto
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Sender keys give every room member its own symmetric chain: a member
+// encrypts with its chain and hands the chain key to the other members once,
+// sealed with SealKeyShare. Each message advances the chain, so a leaked
+// message key exposes neither earlier nor later messages. When membership
+// changes every member starts a new chain and shares it only with the
+// current members, which locks departed members out of future traffic.
+
+const (
+	chainKeySize     = 32
+	senderHeaderSize = 4 + 4 // key ID, iteration
+	// maxSkippedKeys bounds how far ahead of the receiver a sender may be
+	maxSkippedKeys = 1000
+)
+
+var (
+	ErrUnknownSenderKey = errors.New("message encrypted with an unknown sender key")
+	ErrTooManySkipped   = errors.New("too many skipped messages")
+	ErrMessageReplayed  = errors.New("message key already used")
+)
+
+// SenderKey is the sending side of a member's chain.
+type SenderKey struct {
+	KeyID     uint32
+	Iteration uint32
+	ChainKey  []byte
+}
+
+func NewSenderKey() (*SenderKey, error) {
+	var id [4]byte
+	if _, err := io.ReadFull(rand.Reader, id[:]); err != nil {
+		return nil, err
+	}
+	chainKey := make([]byte, chainKeySize)
+	if _, err := io.ReadFull(rand.Reader, chainKey); err != nil {
+		return nil, err
+	}
+	return &SenderKey{KeyID: binary.BigEndian.Uint32(id[:]), ChainKey: chainKey}, nil
+}
+
+// Marshal encodes the current chain state for distribution to members.
+func (sk *SenderKey) Marshal() []byte {
+	b := make([]byte, senderHeaderSize, senderHeaderSize+len(sk.ChainKey))
+	binary.BigEndian.PutUint32(b[0:4], sk.KeyID)
+	binary.BigEndian.PutUint32(b[4:8], sk.Iteration)
+	return append(b, sk.ChainKey...)
+}
+
+// Encrypt seals plaintext with the next message key of the chain. The room ID
+// and epoch are bound as associated data.
+func (sk *SenderKey) Encrypt(roomID string, epoch uint64, plaintext []byte) ([]byte, error) {
+	messageKey, next := ratchet(sk.ChainKey)
+	header := make([]byte, senderHeaderSize)
+	binary.BigEndian.PutUint32(header[0:4], sk.KeyID)
+	binary.BigEndian.PutUint32(header[4:8], sk.Iteration)
+
+	gcm, err := newGCM(messageKey)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+
+	sk.ChainKey = next
+	sk.Iteration++
+
+	out := append(header, nonce...)
+	return gcm.Seal(out, nonce, plaintext, senderAD(header, roomID, epoch)), nil
+}
+
+// SenderKeyReceiver is the receiving side of another member's chain.
+type SenderKeyReceiver struct {
+	keyID     uint32
+	iteration uint32
+	chainKey  []byte
+	skipped   map[uint32][]byte // iteration -> message key
+}
+
+// NewSenderKeyReceiver loads a chain state produced by SenderKey.Marshal.
+func NewSenderKeyReceiver(state []byte) (*SenderKeyReceiver, error) {
+	if len(state) != senderHeaderSize+chainKeySize {
+		return nil, fmt.Errorf("sender key state must be %d bytes", senderHeaderSize+chainKeySize)
+	}
+	return &SenderKeyReceiver{
+		keyID:     binary.BigEndian.Uint32(state[0:4]),
+		iteration: binary.BigEndian.Uint32(state[4:8]),
+		chainKey:  append([]byte(nil), state[senderHeaderSize:]...),
+		skipped:   make(map[uint32][]byte),
+	}, nil
+}
+
+// Decrypt opens a message produced by the matching SenderKey. Messages may
+// arrive out of order; keys of skipped messages are kept until used.
+func (r *SenderKeyReceiver) Decrypt(roomID string, epoch uint64, ciphertext []byte) ([]byte, error) {
+	if len(ciphertext) < senderHeaderSize {
+		return nil, ErrUnknownSenderKey
+	}
+	header := ciphertext[:senderHeaderSize]
+	if binary.BigEndian.Uint32(header[0:4]) != r.keyID {
+		return nil, ErrUnknownSenderKey
+	}
+	iteration := binary.BigEndian.Uint32(header[4:8])
+
+	messageKey, err := r.messageKey(iteration)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := newGCM(messageKey)
+	if err != nil {
+		return nil, err
+	}
+	body := ciphertext[senderHeaderSize:]
+	if len(body) < gcm.NonceSize() {
+		return nil, ErrDecrypt
+	}
+	nonce, sealed := body[:gcm.NonceSize()], body[gcm.NonceSize():]
+	plaintext, err := gcm.Open(nil, nonce, sealed, senderAD(header, roomID, epoch))
+	if err != nil {
+		return nil, ErrDecrypt
+	}
+	delete(r.skipped, iteration)
+	return plaintext, nil
+}
+
+func (r *SenderKeyReceiver) messageKey(iteration uint32) ([]byte, error) {
+	if iteration < r.iteration {
+		if key, ok := r.skipped[iteration]; ok {
+			return key, nil
+		}
+		return nil, ErrMessageReplayed
+	}
+	if iteration-r.iteration > maxSkippedKeys || len(r.skipped)+int(iteration-r.iteration) > maxSkippedKeys {
+		return nil, ErrTooManySkipped
+	}
+
+	for r.iteration < iteration {
+		var key []byte
+		key, r.chainKey = ratchet(r.chainKey)
+		r.skipped[r.iteration] = key
+		r.iteration++
+	}
+	key, next := ratchet(r.chainKey)
+	r.chainKey = next
+	r.iteration++
+	// Kept until Decrypt succeeds, so a forged message cannot burn the key
+	r.skipped[iteration] = key
+	return key, nil
+}
+
+// ratchet derives the message key for the current chain key and the chain
+// key that follows it.
+func ratchet(chainKey []byte) (messageKey, next []byte) {
+	mac := hmac.New(sha256.New, chainKey)
+	mac.Write([]byte{0x01})
+	messageKey = mac.Sum(nil)
+
+	mac = hmac.New(sha256.New, chainKey)
+	mac.Write([]byte{0x02})
+	return messageKey, mac.Sum(nil)
+}
+
+func senderAD(header []byte, roomID string, epoch uint64) []byte {
+	ad := make([]byte, 0, len(header)+8+len(roomID))
+	ad = append(ad, header...)
+	ad = binary.BigEndian.AppendUint64(ad, epoch)
+	return append(ad, roomID...)
+}
@@ -0,0 +1,145 @@
+package crypto
+
+import (
+	"errors"
+	"testing"
+)
+
+func newTestChain(t *testing.T) (*SenderKey, *SenderKeyReceiver) {
+	t.Helper()
+	sender, err := NewSenderKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	receiver, err := NewSenderKeyReceiver(sender.Marshal())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return sender, receiver
+}
+
+func TestSenderKeyRoundTrip(t *testing.T) {
+	sender, receiver := newTestChain(t)
+	for _, text := range []string{"one", "two", "three"} {
+		ciphertext, err := sender.Encrypt("room", 1, []byte(text))
+		if err != nil {
+			t.Fatal(err)
+		}
+		plaintext, err := receiver.Decrypt("room", 1, ciphertext)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(plaintext) != text {
+			t.Errorf("got %q, want %q", plaintext, text)
+		}
+	}
+}
+
+func TestSenderKeyOutOfOrderAndReplay(t *testing.T) {
+	sender, receiver := newTestChain(t)
+	var ciphertexts [][]byte
+	for range 3 {
+		ciphertext, err := sender.Encrypt("room", 1, []byte("hi"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		ciphertexts = append(ciphertexts, ciphertext)
+	}
+
+	for _, i := range []int{2, 0, 1} {
+		if _, err := receiver.Decrypt("room", 1, ciphertexts[i]); err != nil {
+			t.Fatalf("message %d: %v", i, err)
+		}
+	}
+	if _, err := receiver.Decrypt("room", 1, ciphertexts[1]); !errors.Is(err, ErrMessageReplayed) {
+		t.Errorf("replay: got %v, want ErrMessageReplayed", err)
+	}
+}
+
+func TestSenderKeyRejectsTampering(t *testing.T) {
+	sender, receiver := newTestChain(t)
+	ciphertext, err := sender.Encrypt("room", 1, []byte("hi"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tampered := append([]byte(nil), ciphertext...)
+	tampered[len(tampered)-1] ^= 1
+	if _, err := receiver.Decrypt("room", 1, tampered); !errors.Is(err, ErrDecrypt) {
+		t.Errorf("tampered: got %v, want ErrDecrypt", err)
+	}
+	// A forged message must not burn the key of the real one
+	if _, err := receiver.Decrypt("room", 1, ciphertext); err != nil {
+		t.Errorf("genuine message after forgery: %v", err)
+	}
+}
+
+func TestSenderKeyRejectsOtherRoomOrEpoch(t *testing.T) {
+	sender, receiver := newTestChain(t)
+	ciphertext, err := sender.Encrypt("room", 1, []byte("hi"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := receiver.Decrypt("other", 1, ciphertext); !errors.Is(err, ErrDecrypt) {
+		t.Errorf("other room: got %v, want ErrDecrypt", err)
+	}
+	if _, err := receiver.Decrypt("room", 2, ciphertext); !errors.Is(err, ErrDecrypt) {
+		t.Errorf("other epoch: got %v, want ErrDecrypt", err)
+	}
+}
+
+func TestSenderKeyRejectsOtherChain(t *testing.T) {
+	sender, _ := newTestChain(t)
+	_, receiver := newTestChain(t)
+	ciphertext, err := sender.Encrypt("room", 1, []byte("hi"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := receiver.Decrypt("room", 1, ciphertext); !errors.Is(err, ErrUnknownSenderKey) {
+		t.Errorf("got %v, want ErrUnknownSenderKey", err)
+	}
+	if _, err := receiver.Decrypt("room", 1, ciphertext[:3]); !errors.Is(err, ErrUnknownSenderKey) {
+		t.Errorf("short: got %v, want ErrUnknownSenderKey", err)
+	}
+}
+
+func TestSenderKeyLimitsSkippedMessages(t *testing.T) {
+	sender, receiver := newTestChain(t)
+	sender.Iteration = maxSkippedKeys + 1
+	ciphertext, err := sender.Encrypt("room", 1, []byte("hi"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := receiver.Decrypt("room", 1, ciphertext); !errors.Is(err, ErrTooManySkipped) {
+		t.Errorf("got %v, want ErrTooManySkipped", err)
+	}
+}
+
+func TestSenderKeyReceiverJoinsMidChain(t *testing.T) {
+	sender, _ := newTestChain(t)
+	early, err := sender.Encrypt("room", 1, []byte("before"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	receiver, err := NewSenderKeyReceiver(sender.Marshal())
+	if err != nil {
+		t.Fatal(err)
+	}
+	late, err := sender.Encrypt("room", 1, []byte("after"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := receiver.Decrypt("room", 1, early); err == nil {
+		t.Error("a member joining later read an earlier message")
+	}
+	if _, err := receiver.Decrypt("room", 1, late); err != nil {
+		t.Errorf("later message: %v", err)
+	}
+}
+
+func TestNewSenderKeyReceiverRejectsBadState(t *testing.T) {
+	if _, err := NewSenderKeyReceiver(make([]byte, 10)); err == nil {
+		t.Error("expected an error")
+	}
+}
@@ -0,0 +1,114 @@
+package crypto
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+)
+
+// Shamir secret sharing over GF(2^8). A share is its x coordinate followed by
+// one polynomial evaluation per secret byte.
+
+var ErrInvalidShares = errors.New("invalid secret shares")
+
+// SplitSecret splits secret into n shares, any threshold of which recover it.
+func SplitSecret(secret []byte, n, threshold int) ([][]byte, error) {
+	if threshold < 2 || threshold > n || n > 255 {
+		return nil, fmt.Errorf("need 2 <= threshold <= shares <= 255, got %d of %d", threshold, n)
+	}
+	if len(secret) == 0 {
+		return nil, errors.New("empty secret")
+	}
+
+	shares := make([][]byte, n)
+	for i := range shares {
+		shares[i] = make([]byte, len(secret)+1)
+		shares[i][0] = byte(i + 1)
+	}
+
+	coeffs := make([]byte, threshold)
+	for b, s := range secret {
+		coeffs[0] = s
+		if _, err := rand.Read(coeffs[1:]); err != nil {
+			return nil, err
+		}
+		for _, share := range shares {
+			share[b+1] = evalPolynomial(coeffs, share[0])
+		}
+	}
+	clear(coeffs)
+	return shares, nil
+}
+
+// CombineShares recovers the secret from shares produced by SplitSecret. With
+// fewer shares than the threshold the result is garbage, not an error; check
+// it against a KeyCheck value.
+func CombineShares(shares [][]byte) ([]byte, error) {
+	if len(shares) < 2 {
+		return nil, ErrInvalidShares
+	}
+	size := len(shares[0])
+	seen := make(map[byte]bool, len(shares))
+	for _, share := range shares {
+		if len(share) != size || size < 2 || share[0] == 0 || seen[share[0]] {
+			return nil, ErrInvalidShares
+		}
+		seen[share[0]] = true
+	}
+
+	// Lagrange interpolation at x = 0; subtraction is xor in GF(2^8)
+	secret := make([]byte, size-1)
+	for i, si := range shares {
+		basis := byte(1)
+		for j, sj := range shares {
+			if i != j {
+				basis = gfMul(basis, gfMul(sj[0], gfInv(sj[0]^si[0])))
+			}
+		}
+		for b := range secret {
+			secret[b] ^= gfMul(si[b+1], basis)
+		}
+	}
+	return secret, nil
+}
+
+// KeyCheck identifies a key without revealing it, so a recombined key can be
+// compared with the one that was split.
+func KeyCheck(key []byte) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte("hush key check"))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil)[:16])
+}
+
+func evalPolynomial(coeffs []byte, x byte) byte {
+	// Horner's method, highest coefficient first
+	var y byte
+	for i := len(coeffs) - 1; i >= 0; i-- {
+		y = gfMul(y, x) ^ coeffs[i]
+	}
+	return y
+}
+
+// gfMul multiplies in GF(2^8) modulo x^8 + x^4 + x^3 + x + 1 without
+// branching on its inputs.
+func gfMul(a, b byte) byte {
+	var p byte
+	for range 8 {
+		p ^= a & -(b & 1)
+		a = (a << 1) ^ (0x1b & -(a >> 7))
+		b >>= 1
+	}
+	return p
+}
+
+// gfInv returns a^254, the multiplicative inverse of a non-zero a.
+func gfInv(a byte) byte {
+	result := byte(1)
+	for range 254 {
+		result = gfMul(result, a)
+	}
+	return result
+}
@@ -0,0 +1,89 @@
+package crypto
+
+import (
+	"bytes"
+	"crypto/rand"
+	"errors"
+	"testing"
+)
+
+func TestCombineSharesRecoversSecret(t *testing.T) {
+	secret := make([]byte, 32)
+	rand.Read(secret)
+
+	shares, err := SplitSecret(secret, 5, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	subsets := [][]int{{0, 1, 2}, {2, 3, 4}, {0, 2, 4}, {4, 1, 3}, {0, 1, 2, 3, 4}}
+	for _, subset := range subsets {
+		var picked [][]byte
+		for _, i := range subset {
+			picked = append(picked, shares[i])
+		}
+		got, err := CombineShares(picked)
+		if err != nil {
+			t.Fatalf("shares %v: %v", subset, err)
+		}
+		if !bytes.Equal(got, secret) {
+			t.Errorf("shares %v recombined to the wrong secret", subset)
+		}
+	}
+}
+
+func TestCombineSharesBelowThreshold(t *testing.T) {
+	secret := []byte("master key material")
+	shares, err := SplitSecret(secret, 5, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := CombineShares(shares[:2])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Equal(got, secret) {
+		t.Error("two of three shares recovered the secret")
+	}
+	if KeyCheck(got) == KeyCheck(secret) {
+		t.Error("key check matched a wrong secret")
+	}
+}
+
+func TestCombineSharesRejectsBadShares(t *testing.T) {
+	shares, err := SplitSecret([]byte("secret"), 3, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cases := map[string][][]byte{
+		"single share":    {shares[0]},
+		"duplicate x":     {shares[0], shares[0]},
+		"zero x":          {append([]byte{0}, shares[0][1:]...), shares[1]},
+		"length mismatch": {shares[0], shares[1][:3]},
+		"no payload":      {{1}, {2}},
+	}
+	for name, picked := range cases {
+		if _, err := CombineShares(picked); !errors.Is(err, ErrInvalidShares) {
+			t.Errorf("%s: got %v, want ErrInvalidShares", name, err)
+		}
+	}
+}
+
+func TestSplitSecretRejectsBadParameters(t *testing.T) {
+	cases := []struct{ n, threshold int }{{3, 1}, {2, 3}, {256, 2}}
+	for _, c := range cases {
+		if _, err := SplitSecret([]byte("secret"), c.n, c.threshold); err == nil {
+			t.Errorf("%d of %d: expected an error", c.threshold, c.n)
+		}
+	}
+	if _, err := SplitSecret(nil, 3, 2); err == nil {
+		t.Error("empty secret: expected an error")
+	}
+}
+
+func TestGFInverse(t *testing.T) {
+	for a := 1; a < 256; a++ {
+		if got := gfMul(byte(a), gfInv(byte(a))); got != 1 {
+			t.Fatalf("%d * inv(%d) = %d", a, a, got)
+		}
+	}
+}
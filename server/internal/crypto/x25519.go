@@ -0,0 +1,100 @@
+package crypto
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/hkdf"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"io"
+)
+
+const keyShareInfo = "hush key share v1"
+
+var ErrInvalidKeyShare = errors.New("invalid key share")
+
+// GenerateKeyPair creates an X25519 key pair for room key exchange. Only the
+// public half is ever sent to the server, in a key bundle.
+func GenerateKeyPair() (*ecdh.PrivateKey, error) {
+	return ecdh.X25519().GenerateKey(rand.Reader)
+}
+
+// ParsePublicKey validates a 32 byte X25519 public key.
+func ParsePublicKey(b []byte) (*ecdh.PublicKey, error) {
+	return ecdh.X25519().NewPublicKey(b)
+}
+
+// Fingerprint identifies a public key without revealing anything else about
+// its owner. Key shares are addressed by fingerprint.
+func Fingerprint(publicKey []byte) string {
+	sum := sha256.Sum256(publicKey)
+	return base64.RawURLEncoding.EncodeToString(sum[:16])
+}
+
+// SealKeyShare encrypts a symmetric room key for one recipient. The wrapping
+// key is derived from the X25519 shared secret of sender and recipient and
+// bound to the room, so a share cannot be replayed into another room.
+func SealKeyShare(sender *ecdh.PrivateKey, recipient []byte, roomID string, roomKey []byte) ([]byte, error) {
+	gcm, err := keyShareCipher(sender, sender.PublicKey().Bytes(), recipient, recipient, roomID)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+	return gcm.Seal(nonce, nonce, roomKey, nil), nil
+}
+
+// OpenKeyShare decrypts a key share sealed by the owner of sender for the
+// owner of recipient.
+func OpenKeyShare(recipient *ecdh.PrivateKey, sender []byte, roomID string, share []byte) ([]byte, error) {
+	gcm, err := keyShareCipher(recipient, sender, recipient.PublicKey().Bytes(), sender, roomID)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(share) < gcm.NonceSize() {
+		return nil, ErrInvalidKeyShare
+	}
+	nonce, ciphertext := share[:gcm.NonceSize()], share[gcm.NonceSize():]
+	roomKey, err := gcm.Open(nil, nonce, ciphertext, nil)
+	if err != nil {
+		return nil, ErrInvalidKeyShare
+	}
+	return roomKey, nil
+}
+
+// keyShareCipher derives the AEAD shared by a sender and a recipient. Both
+// sides pass the public keys in sender, recipient order so they derive the
+// same key; peer is the other side's public key.
+func keyShareCipher(own *ecdh.PrivateKey, senderKey, recipientKey, peer []byte, roomID string) (cipher.AEAD, error) {
+	peerKey, err := ParsePublicKey(peer)
+	if err != nil {
+		return nil, err
+	}
+	shared, err := own.ECDH(peerKey)
+	if err != nil {
+		return nil, err
+	}
+
+	info := make([]byte, 0, len(keyShareInfo)+len(senderKey)+len(recipientKey)+len(roomID))
+	info = append(info, keyShareInfo...)
+	info = append(info, senderKey...)
+	info = append(info, recipientKey...)
+	info = append(info, roomID...)
+
+	key, err := hkdf.Key(sha256.New, shared, nil, string(info), 32)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,244 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+)
+
+// DeferredStore keeps messages in a fallback store until a persistent store
+// is attached, for servers that start before their storage key is available.
+// Room settings, invites, bans and read markers are copied over on Attach.
+// Messages written before Attach stay in the fallback and are not migrated,
+// but can still be edited, deleted and replied to, and queued direct
+// messages are still delivered.
+type DeferredStore struct {
+	mu       sync.RWMutex
+	fallback *MemoryStore
+	store    MessageStore
+}
+
+func NewDeferredStore(fallback *MemoryStore) *DeferredStore {
+	return &DeferredStore{fallback: fallback}
+}
+
+// Attach copies the fallback's room state to store and switches reads and
+// writes to it. It may be called once; if copying fails, nothing switches.
+func (ds *DeferredStore) Attach(ctx context.Context, store MessageStore) error {
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+
+	if ds.store != nil {
+		return errors.New("persistent store already attached")
+	}
+	if err := ds.fallback.CopyRooms(ctx, store); err != nil {
+		return fmt.Errorf("copy room state: %w", err)
+	}
+	ds.store = store
+	return nil
+}
+
+// Persistent reports whether a persistent store is attached.
+func (ds *DeferredStore) Persistent() bool {
+	ds.mu.RLock()
+	defer ds.mu.RUnlock()
+	return ds.store != nil
+}
+
+func (ds *DeferredStore) current() MessageStore {
+	ds.mu.RLock()
+	defer ds.mu.RUnlock()
+	if ds.store != nil {
+		return ds.store
+	}
+	return ds.fallback
+}
+
+// all returns the stores that may hold data, fallback first.
+func (ds *DeferredStore) all() []MessageStore {
+	ds.mu.RLock()
+	defer ds.mu.RUnlock()
+	if ds.store != nil {
+		return []MessageStore{ds.fallback, ds.store}
+	}
+	return []MessageStore{ds.fallback}
+}
+
+// orFallback runs op on the current store and, if that one does not have
+// what op looks for, on the fallback.
+func (ds *DeferredStore) orFallback(op func(MessageStore) error) error {
+	stores := ds.all()
+	err := op(stores[len(stores)-1])
+	if errors.Is(err, ErrNotFound) && len(stores) > 1 {
+		return op(stores[0])
+	}
+	return err
+}
+
+func (ds *DeferredStore) SaveMessage(ctx context.Context, msg *Message) error {
+	return ds.current().SaveMessage(ctx, msg)
+}
+
+func (ds *DeferredStore) Message(ctx context.Context, roomID, id string) (Message, error) {
+	var msg Message
+	err := ds.orFallback(func(store MessageStore) error {
+		var err error
+		msg, err = store.Message(ctx, roomID, id)
+		return err
+	})
+	return msg, err
+}
+
+func (ds *DeferredStore) UpdateMessage(ctx context.Context, roomID, id string, update func(*Message) error) error {
+	return ds.orFallback(func(store MessageStore) error {
+		return store.UpdateMessage(ctx, roomID, id, update)
+	})
+}
+
+func (ds *DeferredStore) DeleteMessage(ctx context.Context, roomID, id string) error {
+	return ds.orFallback(func(store MessageStore) error {
+		return store.DeleteMessage(ctx, roomID, id)
+	})
+}
+
+func (ds *DeferredStore) History(ctx context.Context, roomID string, q HistoryQuery) ([]Message, error) {
+	return ds.current().History(ctx, roomID, q)
+}
+
+func (ds *DeferredStore) ClaimRoom(ctx context.Context, roomID, owner string) (RoomSettings, error) {
+	return ds.current().ClaimRoom(ctx, roomID, owner)
+}
+
+func (ds *DeferredStore) RoomSettings(ctx context.Context, roomID string) (RoomSettings, error) {
+	return ds.current().RoomSettings(ctx, roomID)
+}
+
+func (ds *DeferredStore) SaveRoomSettings(ctx context.Context, settings RoomSettings) error {
+	return ds.current().SaveRoomSettings(ctx, settings)
+}
+
+func (ds *DeferredStore) AddInvite(ctx context.Context, roomID string, codeHash []byte, expiresAt time.Time) error {
+	return ds.current().AddInvite(ctx, roomID, codeHash, expiresAt)
+}
+
+func (ds *DeferredStore) UseInvite(ctx context.Context, roomID string, codeHash []byte) (bool, error) {
+	return ds.current().UseInvite(ctx, roomID, codeHash)
+}
+
+func (ds *DeferredStore) BanFromRoom(ctx context.Context, roomID, target string, until time.Time) error {
+	return ds.current().BanFromRoom(ctx, roomID, target, until)
+}
+
+func (ds *DeferredStore) Banned(ctx context.Context, roomID string, targets ...string) (bool, error) {
+	return ds.current().Banned(ctx, roomID, targets...)
+}
+
+func (ds *DeferredStore) MarkRead(ctx context.Context, roomID string, marker ReadMarker) error {
+	return ds.current().MarkRead(ctx, roomID, marker)
+}
+
+func (ds *DeferredStore) ReadMarkers(ctx context.Context, roomID string, limit int) ([]ReadMarker, error) {
+	return ds.current().ReadMarkers(ctx, roomID, limit)
+}
+
+func (ds *DeferredStore) SaveIdentity(ctx context.Context, fingerprint string, publicKey []byte) error {
+	return ds.current().SaveIdentity(ctx, fingerprint, publicKey)
+}
+
+func (ds *DeferredStore) IdentityExists(ctx context.Context, fingerprint string) (bool, error) {
+	return ds.current().IdentityExists(ctx, fingerprint)
+}
+
+func (ds *DeferredStore) QueueDirect(ctx context.Context, msg *DirectMessage, limits DirectLimits) error {
+	return ds.current().QueueDirect(ctx, msg, limits)
+}
+
+func (ds *DeferredStore) DirectMessage(ctx context.Context, id string) (DirectMessage, error) {
+	var msg DirectMessage
+	err := ds.orFallback(func(store MessageStore) error {
+		var err error
+		msg, err = store.DirectMessage(ctx, id)
+		return err
+	})
+	return msg, err
+}
+
+// PendingDirect drains the fallback's queue first, as it holds the older
+// messages.
+func (ds *DeferredStore) PendingDirect(ctx context.Context, recipient string, limit int) ([]DirectMessage, error) {
+	var pending []DirectMessage
+	for _, store := range ds.all() {
+		if len(pending) == limit {
+			break
+		}
+		msgs, err := store.PendingDirect(ctx, recipient, limit-len(pending))
+		if err != nil {
+			return pending, err
+		}
+		pending = append(pending, msgs...)
+	}
+	return pending, nil
+}
+
+func (ds *DeferredStore) AckDirect(ctx context.Context, recipient string, ids []string) error {
+	var errs []error
+	for _, store := range ds.all() {
+		errs = append(errs, store.AckDirect(ctx, recipient, ids))
+	}
+	return errors.Join(errs...)
+}
+
+// Activity and deletions reach the fallback as well, so messages kept in
+// memory before Attach still expire, but not while their room is in use.
+
+func (ds *DeferredStore) TouchRoom(ctx context.Context, roomID string) error {
+	var errs []error
+	for _, store := range ds.all() {
+		errs = append(errs, store.TouchRoom(ctx, roomID))
+	}
+	return errors.Join(errs...)
+}
+
+func (ds *DeferredStore) DeleteExpired(ctx context.Context, now time.Time) ([]Message, error) {
+	var expired []Message
+	for _, store := range ds.all() {
+		msgs, err := store.DeleteExpired(ctx, now)
+		if err != nil {
+			return expired, err
+		}
+		expired = append(expired, msgs...)
+	}
+	return expired, nil
+}
+
+func (ds *DeferredStore) DeleteRoom(ctx context.Context, roomID string) error {
+	var errs []error
+	for _, store := range ds.all() {
+		errs = append(errs, store.DeleteRoom(ctx, roomID))
+	}
+	return errors.Join(errs...)
+}
+
+func (ds *DeferredStore) DeleteIdleRooms(ctx context.Context, idle time.Duration) ([]string, error) {
+	var deleted []string
+	for _, store := range ds.all() {
+		rooms, err := store.DeleteIdleRooms(ctx, idle)
+		if err != nil {
+			return deleted, err
+		}
+		deleted = append(deleted, rooms...)
+	}
+	slices.Sort(deleted)
+	return slices.Compact(deleted), nil
+}
+
+func (ds *DeferredStore) Close() error {
+	var errs []error
+	for _, store := range ds.all() {
+		errs = append(errs, store.Close())
+	}
+	return errors.Join(errs...)
+}
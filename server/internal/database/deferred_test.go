@@ -0,0 +1,142 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestDeferredStoreAttachCopiesRoomState(t *testing.T) {
+	ctx := context.Background()
+	ds := NewDeferredStore(NewMemoryStore(0))
+
+	settings, err := ds.ClaimRoom(ctx, "room", "owner")
+	if err != nil {
+		t.Fatal(err)
+	}
+	settings.Policy = PolicyInvite
+	settings.Locked = true
+	if err := ds.SaveRoomSettings(ctx, settings); err != nil {
+		t.Fatal(err)
+	}
+	if err := ds.AddInvite(ctx, "room", []byte("code"), time.Now().Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if err := ds.BanFromRoom(ctx, "room", "banned", time.Now().Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if err := ds.MarkRead(ctx, "room", ReadMarker{Member: "member", Seq: 3}); err != nil {
+		t.Fatal(err)
+	}
+
+	store := NewMemoryStore(0)
+	if err := ds.Attach(ctx, store); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := store.RoomSettings(ctx, "room")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Owner != "owner" || got.Policy != PolicyInvite || !got.Locked {
+		t.Errorf("settings not copied: %+v", got)
+	}
+	if banned, _ := store.Banned(ctx, "room", "banned"); !banned {
+		t.Error("ban not copied")
+	}
+	if valid, _ := store.UseInvite(ctx, "room", []byte("code")); !valid {
+		t.Error("invite not copied")
+	}
+	if markers, _ := store.ReadMarkers(ctx, "room", 10); len(markers) != 1 || markers[0].Seq != 3 {
+		t.Errorf("read markers not copied: %+v", markers)
+	}
+}
+
+func TestDeferredStoreAttachKeepsPersistentOwner(t *testing.T) {
+	ctx := context.Background()
+	ds := NewDeferredStore(NewMemoryStore(0))
+	settings, _ := ds.ClaimRoom(ctx, "room", "newcomer")
+	settings.Policy = PolicyInvite
+	ds.SaveRoomSettings(ctx, settings)
+	ds.AddInvite(ctx, "room", []byte("code"), time.Now().Add(time.Hour))
+
+	store := NewMemoryStore(0)
+	store.ClaimRoom(ctx, "room", "owner")
+	if err := ds.Attach(ctx, store); err != nil {
+		t.Fatal(err)
+	}
+
+	got, _ := store.RoomSettings(ctx, "room")
+	if got.Owner != "owner" || got.Policy != PolicyOpen {
+		t.Errorf("persistent settings overridden: %+v", got)
+	}
+	if valid, _ := store.UseInvite(ctx, "room", []byte("code")); valid {
+		t.Error("invite of the sealed-time owner copied")
+	}
+}
+
+func TestDeferredStoreChangesFallbackMessages(t *testing.T) {
+	ctx := context.Background()
+	ds := NewDeferredStore(NewMemoryStore(0))
+	for _, id := range []string{"edited", "deleted"} {
+		if err := ds.SaveMessage(ctx, &Message{ID: id, RoomID: "room", Content: []byte("before")}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := ds.Attach(ctx, NewMemoryStore(0)); err != nil {
+		t.Fatal(err)
+	}
+
+	err := ds.UpdateMessage(ctx, "room", "edited", func(msg *Message) error {
+		msg.Content = []byte("after")
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg, err := ds.Message(ctx, "room", "edited")
+	if err != nil || string(msg.Content) != "after" {
+		t.Errorf("edit lost: %q, %v", msg.Content, err)
+	}
+	if err := ds.DeleteMessage(ctx, "room", "deleted"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ds.Message(ctx, "room", "deleted"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("got %v, want ErrNotFound", err)
+	}
+}
+
+var testDirectLimits = DirectLimits{Queued: 10, PerSender: 10}
+
+func TestDeferredStoreDeliversFallbackDirectMessages(t *testing.T) {
+	ctx := context.Background()
+	ds := NewDeferredStore(NewMemoryStore(0))
+	ds.SaveIdentity(ctx, "alice", nil)
+	expires := time.Now().Add(time.Hour)
+	ds.QueueDirect(ctx, &DirectMessage{ID: "old", Recipient: "alice", ExpiresAt: expires}, testDirectLimits)
+
+	store := NewMemoryStore(0)
+	if err := ds.Attach(ctx, store); err != nil {
+		t.Fatal(err)
+	}
+	store.SaveIdentity(ctx, "alice", nil)
+	ds.QueueDirect(ctx, &DirectMessage{ID: "new", Recipient: "alice", ExpiresAt: expires}, testDirectLimits)
+
+	pending, err := ds.PendingDirect(ctx, "alice", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pending) != 2 || pending[0].ID != "old" || pending[1].ID != "new" {
+		t.Fatalf("pending: %+v", pending)
+	}
+	if pending, _ := ds.PendingDirect(ctx, "alice", 1); len(pending) != 1 {
+		t.Errorf("limit ignored: %+v", pending)
+	}
+	if err := ds.AckDirect(ctx, "alice", []string{"old", "new"}); err != nil {
+		t.Fatal(err)
+	}
+	if pending, _ := ds.PendingDirect(ctx, "alice", 10); len(pending) != 0 {
+		t.Errorf("acknowledged messages still pending: %+v", pending)
+	}
+}
@@ -0,0 +1,276 @@
+package database
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DiskFileStore keeps every room's files in a directory of its own under dir,
+// named by a hash of the room ID. Each file's content sits next to a JSON
+// description; the bytes received are the content's length, and its
+// modification time is the upload's last progress.
+type DiskFileStore struct {
+	mu  sync.Mutex
+	dir string
+}
+
+func NewDiskFileStore(dir string) (*DiskFileStore, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, err
+	}
+	return &DiskFileStore{dir: dir}, nil
+}
+
+func (ds *DiskFileStore) CreateFile(_ context.Context, file *File, quota int64) error {
+	if !validFileID(file.ID) {
+		return fmt.Errorf("invalid file ID %q", file.ID)
+	}
+	if file.CreatedAt.IsZero() {
+		file.CreatedAt = time.Now().UTC()
+	}
+
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+
+	roomDir := ds.roomDir(file.RoomID)
+	if err := os.MkdirAll(roomDir, 0o700); err != nil {
+		return err
+	}
+	usage, err := ds.usage(roomDir)
+	if err != nil {
+		return err
+	}
+	if usage+file.Size > quota {
+		return ErrQuotaExceeded
+	}
+
+	content, err := os.OpenFile(filepath.Join(roomDir, file.ID), os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+	content.Close()
+	file.Received = 0
+	file.Complete = false
+	return ds.writeInfo(roomDir, *file)
+}
+
+func (ds *DiskFileStore) File(_ context.Context, roomID, id string) (File, error) {
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+	return ds.file(roomID, id)
+}
+
+func (ds *DiskFileStore) AppendChunk(_ context.Context, roomID, id string, offset int64, data []byte, quota int64) (int64, error) {
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+
+	file, err := ds.file(roomID, id)
+	if err != nil {
+		return 0, err
+	}
+	if file.Complete || offset != file.Received || offset+int64(len(data)) > file.Size {
+		return file.Received, ErrBadOffset
+	}
+	usage, err := ds.usage(ds.roomDir(roomID))
+	if err != nil {
+		return file.Received, err
+	}
+	if usage+int64(len(data)) > quota {
+		return file.Received, ErrQuotaExceeded
+	}
+
+	content, err := os.OpenFile(filepath.Join(ds.roomDir(roomID), id), os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		return file.Received, err
+	}
+	defer content.Close()
+	if _, err := content.Write(data); err != nil {
+		// A partial write is cut off again, so the upload can resume
+		content.Truncate(offset)
+		return file.Received, err
+	}
+	return offset + int64(len(data)), content.Sync()
+}
+
+func (ds *DiskFileStore) CompleteFile(_ context.Context, roomID, id string) error {
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+
+	file, err := ds.file(roomID, id)
+	if err != nil {
+		return err
+	}
+	if file.Received != file.Size {
+		return ErrIncomplete
+	}
+	file.Complete = true
+	return ds.writeInfo(ds.roomDir(roomID), file)
+}
+
+func (ds *DiskFileStore) ReadChunk(_ context.Context, roomID, id string, offset int64, n int) ([]byte, error) {
+	ds.mu.Lock()
+	file, err := ds.file(roomID, id)
+	ds.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	if !file.Complete {
+		return nil, ErrIncomplete
+	}
+
+	content, err := os.Open(filepath.Join(ds.roomDir(roomID), id))
+	if err != nil {
+		return nil, err
+	}
+	defer content.Close()
+	buf := make([]byte, n)
+	read, err := content.ReadAt(buf, offset)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+	return buf[:read], nil
+}
+
+func (ds *DiskFileStore) DeleteRoomFiles(_ context.Context, roomID string) error {
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+	return os.RemoveAll(ds.roomDir(roomID))
+}
+
+func (ds *DiskFileStore) DeleteStaleUploads(_ context.Context, before time.Time) (int, error) {
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+
+	infos, err := filepath.Glob(filepath.Join(ds.dir, "*", "*.json"))
+	if err != nil {
+		return 0, err
+	}
+	deleted := 0
+	for _, path := range infos {
+		file, err := readInfo(path)
+		if err != nil {
+			return deleted, err
+		}
+		if file.Complete {
+			continue
+		}
+		content := strings.TrimSuffix(path, ".json")
+		stat, err := os.Stat(content)
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return deleted, err
+		}
+		if err == nil && !stat.ModTime().Before(before) {
+			continue
+		}
+		if err := os.Remove(path); err != nil {
+			return deleted, err
+		}
+		if err := os.Remove(content); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return deleted, err
+		}
+		deleted++
+	}
+	return deleted, nil
+}
+
+func (ds *DiskFileStore) Close() error {
+	return nil
+}
+
+func (ds *DiskFileStore) roomDir(roomID string) string {
+	sum := sha256.Sum256([]byte(roomID))
+	return filepath.Join(ds.dir, hex.EncodeToString(sum[:16]))
+}
+
+func (ds *DiskFileStore) file(roomID, id string) (File, error) {
+	if !validFileID(id) {
+		return File{}, ErrNotFound
+	}
+	roomDir := ds.roomDir(roomID)
+	info, err := os.ReadFile(filepath.Join(roomDir, id+".json"))
+	if errors.Is(err, fs.ErrNotExist) {
+		return File{}, ErrNotFound
+	}
+	if err != nil {
+		return File{}, err
+	}
+	var file File
+	if err := json.Unmarshal(info, &file); err != nil {
+		return File{}, fmt.Errorf("read file %s: %w", id, err)
+	}
+
+	stat, err := os.Stat(filepath.Join(roomDir, id))
+	if err != nil {
+		return File{}, err
+	}
+	file.Received = stat.Size()
+	return file, nil
+}
+
+// writeInfo replaces a file's description atomically.
+func (ds *DiskFileStore) writeInfo(roomDir string, file File) error {
+	info, err := json.Marshal(file)
+	if err != nil {
+		return err
+	}
+	tmp := filepath.Join(roomDir, file.ID+".json.tmp")
+	if err := os.WriteFile(tmp, info, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, filepath.Join(roomDir, file.ID+".json"))
+}
+
+// usage adds up the sizes of a room's complete files and the bytes received
+// for its unfinished ones.
+func (ds *DiskFileStore) usage(roomDir string) (int64, error) {
+	infos, err := filepath.Glob(filepath.Join(roomDir, "*.json"))
+	if err != nil {
+		return 0, err
+	}
+	var usage int64
+	for _, path := range infos {
+		file, err := readInfo(path)
+		if err != nil {
+			return 0, err
+		}
+		if file.Complete {
+			usage += file.Size
+			continue
+		}
+		stat, err := os.Stat(strings.TrimSuffix(path, ".json"))
+		if err != nil {
+			return 0, err
+		}
+		usage += stat.Size()
+	}
+	return usage, nil
+}
+
+func readInfo(path string) (File, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return File{}, err
+	}
+	var file File
+	if err := json.Unmarshal(data, &file); err != nil {
+		return File{}, fmt.Errorf("read %s: %w", path, err)
+	}
+	return file, nil
+}
+
+// validFileID accepts the server-generated UUIDs, which are safe to use as
+// file names.
+func validFileID(id string) bool {
+	return len(id) == 36 && strings.Trim(id, "0123456789abcdef-") == ""
+}
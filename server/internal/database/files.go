@@ -0,0 +1,51 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+var (
+	ErrQuotaExceeded = errors.New("room file quota exceeded")
+	ErrBadOffset     = errors.New("chunk does not continue the upload")
+	ErrIncomplete    = errors.New("upload is incomplete")
+)
+
+// File is an attachment uploaded to a room in chunks. Its content and
+// Metadata (name, type and the like) are encrypted by the client; the store
+// only sees ciphertext. Size is declared when the upload begins, but only the
+// bytes received count against the room's quota until the upload completes.
+// Owner is the identity fingerprint or session that uploads it.
+type File struct {
+	ID        string
+	RoomID    string
+	Owner     string
+	Metadata  []byte
+	Size      int64
+	Received  int64
+	Complete  bool
+	CreatedAt time.Time
+}
+
+type FileStore interface {
+	// CreateFile registers an upload if it currently fits within the room's
+	// quota bytes; otherwise it returns ErrQuotaExceeded. Nothing is reserved.
+	CreateFile(ctx context.Context, file *File, quota int64) error
+	// File returns a file of a room, or ErrNotFound.
+	File(ctx context.Context, roomID, id string) (File, error)
+	// AppendChunk writes data at offset, which must be the number of bytes
+	// received so far, and returns the new count. It returns
+	// ErrQuotaExceeded if the room's files would outgrow quota bytes.
+	AppendChunk(ctx context.Context, roomID, id string, offset int64, data []byte, quota int64) (int64, error)
+	// CompleteFile marks an upload finished once all of it was received.
+	CompleteFile(ctx context.Context, roomID, id string) error
+	// ReadChunk reads up to n bytes of a complete file from offset.
+	ReadChunk(ctx context.Context, roomID, id string, offset int64, n int) ([]byte, error)
+	// DeleteRoomFiles removes every file of a room.
+	DeleteRoomFiles(ctx context.Context, roomID string) error
+	// DeleteStaleUploads removes unfinished uploads that received nothing
+	// since before and returns how many there were.
+	DeleteStaleUploads(ctx context.Context, before time.Time) (int, error)
+	Close() error
+}
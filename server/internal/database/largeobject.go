@@ -0,0 +1,211 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// roomUsage counts a room's complete files in full and its unfinished ones by
+// the bytes received. Callers hold the room's advisory lock.
+func roomUsage(ctx context.Context, tx *sql.Tx, roomID string) (int64, error) {
+	var usage int64
+	err := tx.QueryRowContext(ctx,
+		"SELECT COALESCE(SUM(CASE WHEN complete THEN size ELSE received END), 0) FROM files WHERE room_id = $1",
+		roomID,
+	).Scan(&usage)
+	return usage, err
+}
+
+// PostgresFileStore keeps file content in Postgres large objects, one per
+// file, described by a row in the files table. Rows reference their large
+// object, which has to be unlinked before the row goes.
+type PostgresFileStore struct {
+	db *sql.DB
+}
+
+func NewPostgresFileStore(db *sql.DB) *PostgresFileStore {
+	return &PostgresFileStore{db: db}
+}
+
+func (ps *PostgresFileStore) CreateFile(ctx context.Context, file *File, quota int64) error {
+	tx, err := ps.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// Serializes uploads to one room, so they cannot overrun its quota together
+	if _, err := tx.ExecContext(ctx, "SELECT pg_advisory_xact_lock(hashtext($1))", file.RoomID); err != nil {
+		return err
+	}
+	usage, err := roomUsage(ctx, tx, file.RoomID)
+	if err != nil {
+		return err
+	}
+	if usage+file.Size > quota {
+		return ErrQuotaExceeded
+	}
+
+	if err := tx.QueryRowContext(ctx,
+		`INSERT INTO files (id, room_id, owner, metadata, size, content)
+		 VALUES ($1, $2, $3, $4, $5, lo_create(0))
+		 RETURNING created_at`,
+		file.ID, file.RoomID, file.Owner, file.Metadata, file.Size,
+	).Scan(&file.CreatedAt); err != nil {
+		return err
+	}
+	file.Received = 0
+	file.Complete = false
+	return tx.Commit()
+}
+
+func (ps *PostgresFileStore) File(ctx context.Context, roomID, id string) (File, error) {
+	file := File{ID: id, RoomID: roomID}
+	err := ps.db.QueryRowContext(ctx,
+		`SELECT owner, metadata, size, received, complete, created_at FROM files
+		 WHERE room_id = $1 AND id = $2`,
+		roomID, id,
+	).Scan(&file.Owner, &file.Metadata, &file.Size, &file.Received, &file.Complete, &file.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return File{}, ErrNotFound
+	}
+	return file, err
+}
+
+func (ps *PostgresFileStore) AppendChunk(ctx context.Context, roomID, id string, offset int64, data []byte, quota int64) (int64, error) {
+	tx, err := ps.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, "SELECT pg_advisory_xact_lock(hashtext($1))", roomID); err != nil {
+		return 0, err
+	}
+
+	var (
+		content  int64
+		size     int64
+		received int64
+		complete bool
+	)
+	err = tx.QueryRowContext(ctx,
+		"SELECT content, size, received, complete FROM files WHERE room_id = $1 AND id = $2 FOR UPDATE",
+		roomID, id,
+	).Scan(&content, &size, &received, &complete)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, ErrNotFound
+	}
+	if err != nil {
+		return 0, err
+	}
+	if complete || offset != received || offset+int64(len(data)) > size {
+		return received, ErrBadOffset
+	}
+	usage, err := roomUsage(ctx, tx, roomID)
+	if err != nil {
+		return received, err
+	}
+	if usage+int64(len(data)) > quota {
+		return received, ErrQuotaExceeded
+	}
+
+	if _, err := tx.ExecContext(ctx, "SELECT lo_put($1, $2, $3)", content, offset, data); err != nil {
+		return received, err
+	}
+	received += int64(len(data))
+	if _, err := tx.ExecContext(ctx,
+		"UPDATE files SET received = $3, updated_at = NOW() WHERE room_id = $1 AND id = $2",
+		roomID, id, received,
+	); err != nil {
+		return offset, err
+	}
+	if err := tx.Commit(); err != nil {
+		return offset, err
+	}
+	return received, nil
+}
+
+func (ps *PostgresFileStore) CompleteFile(ctx context.Context, roomID, id string) error {
+	res, err := ps.db.ExecContext(ctx,
+		"UPDATE files SET complete = true WHERE room_id = $1 AND id = $2 AND received = size",
+		roomID, id,
+	)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		if _, err := ps.File(ctx, roomID, id); err != nil {
+			return err
+		}
+		return ErrIncomplete
+	}
+	return nil
+}
+
+func (ps *PostgresFileStore) ReadChunk(ctx context.Context, roomID, id string, offset int64, n int) ([]byte, error) {
+	var (
+		data     []byte
+		complete bool
+	)
+	err := ps.db.QueryRowContext(ctx,
+		`SELECT CASE WHEN complete THEN lo_get(content, $3, $4) END, complete FROM files
+		 WHERE room_id = $1 AND id = $2`,
+		roomID, id, offset, n,
+	).Scan(&data, &complete)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !complete {
+		return nil, ErrIncomplete
+	}
+	return data, nil
+}
+
+func (ps *PostgresFileStore) DeleteRoomFiles(ctx context.Context, roomID string) error {
+	tx, err := ps.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx,
+		"SELECT lo_unlink(content) FROM files WHERE room_id = $1",
+		roomID,
+	); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, "DELETE FROM files WHERE room_id = $1", roomID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (ps *PostgresFileStore) DeleteStaleUploads(ctx context.Context, before time.Time) (int, error) {
+	rows, err := ps.db.QueryContext(ctx,
+		`WITH stale AS (
+		   DELETE FROM files WHERE NOT complete AND updated_at < $1 RETURNING content
+		 )
+		 SELECT lo_unlink(content) FROM stale`,
+		before,
+	)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	deleted := 0
+	for rows.Next() {
+		deleted++
+	}
+	return deleted, rows.Err()
+}
+
+func (ps *PostgresFileStore) Close() error {
+	return ps.db.Close()
+}
@@ -0,0 +1,482 @@
+package database
+
+import (
+	"context"
+	"maps"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+)
+
+const defaultMemoryRoomCapacity = 1000
+
+// MemoryStore keeps the most recent messages of every room in process memory.
+// It is used when no database is configured; history is lost on restart.
+type MemoryStore struct {
+	mu       sync.RWMutex
+	rooms    map[string][]Message
+	seqs     map[string]int64
+	activity map[string]time.Time
+	settings map[string]RoomSettings
+	invites  map[string]memoryInvite // keyed by code hash
+	bans     map[string]map[string]time.Time
+	markers  map[string]map[string]ReadMarker // room -> member -> marker
+	// identities maps saved identity fingerprints to their queued messages
+	identities map[string][]DirectMessage
+	capacity   int
+}
+
+type memoryInvite struct {
+	roomID    string
+	expiresAt time.Time
+}
+
+func NewMemoryStore(capacity int) *MemoryStore {
+	if capacity <= 0 {
+		capacity = defaultMemoryRoomCapacity
+	}
+	return &MemoryStore{
+		rooms:    make(map[string][]Message),
+		seqs:     make(map[string]int64),
+		activity: make(map[string]time.Time),
+		settings: make(map[string]RoomSettings),
+		invites:  make(map[string]memoryInvite),
+		bans:     make(map[string]map[string]time.Time),
+		markers:  make(map[string]map[string]ReadMarker),
+
+		identities: make(map[string][]DirectMessage),
+		capacity:   capacity,
+	}
+}
+
+func (ms *MemoryStore) SaveMessage(_ context.Context, msg *Message) error {
+	if msg.CreatedAt.IsZero() {
+		msg.CreatedAt = time.Now().UTC()
+	}
+
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	ms.seqs[msg.RoomID]++
+	msg.Seq = ms.seqs[msg.RoomID]
+	ms.activity[msg.RoomID] = time.Now()
+
+	msgs := append(ms.rooms[msg.RoomID], *msg)
+	if len(msgs) > ms.capacity {
+		msgs = msgs[len(msgs)-ms.capacity:]
+	}
+	ms.rooms[msg.RoomID] = msgs
+	return nil
+}
+
+func (ms *MemoryStore) Message(_ context.Context, roomID, id string) (Message, error) {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+
+	for _, msg := range ms.rooms[roomID] {
+		if msg.ID == id && !isExpired(msg, time.Now()) {
+			return msg, nil
+		}
+	}
+	return Message{}, ErrNotFound
+}
+
+func (ms *MemoryStore) UpdateMessage(_ context.Context, roomID, id string, update func(*Message) error) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	msgs := ms.rooms[roomID]
+	i := slices.IndexFunc(msgs, func(msg Message) bool {
+		return msg.ID == id && !isExpired(msg, time.Now())
+	})
+	if i < 0 {
+		return ErrNotFound
+	}
+	msg := msgs[i]
+	if err := update(&msg); err != nil {
+		return err
+	}
+	msgs[i].Content = msg.Content
+	return nil
+}
+
+func (ms *MemoryStore) DeleteMessage(_ context.Context, roomID, id string) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	msgs := ms.rooms[roomID]
+	i := slices.IndexFunc(msgs, func(msg Message) bool { return msg.ID == id })
+	if i < 0 {
+		return ErrNotFound
+	}
+	ms.rooms[roomID] = slices.Delete(msgs, i, i+1)
+	return nil
+}
+
+func (ms *MemoryStore) History(_ context.Context, roomID string, q HistoryQuery) ([]Message, error) {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+
+	msgs := liveMessages(ms.rooms[roomID], time.Now())
+	if q.ThreadID != "" {
+		msgs = slices.DeleteFunc(msgs, func(msg Message) bool {
+			return msg.ID != q.ThreadID && msg.ThreadID != q.ThreadID
+		})
+	}
+	var page []Message
+	if q.Since > 0 {
+		start := sort.Search(len(msgs), func(i int) bool { return msgs[i].Seq > q.Since })
+		end := min(start+q.Limit, len(msgs))
+		page = msgs[start:end]
+	} else {
+		end := len(msgs)
+		if q.Before > 0 {
+			end = sort.Search(len(msgs), func(i int) bool { return msgs[i].Seq >= q.Before })
+		}
+		start := max(end-q.Limit, 0)
+		page = msgs[start:end]
+	}
+
+	return page, nil
+}
+
+func (ms *MemoryStore) DeleteExpired(_ context.Context, now time.Time) ([]Message, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	var expired []Message
+	for roomID, msgs := range ms.rooms {
+		kept := msgs[:0]
+		for _, msg := range msgs {
+			if isExpired(msg, now) {
+				expired = append(expired, Message{ID: msg.ID, RoomID: msg.RoomID, Seq: msg.Seq, ExpiresAt: msg.ExpiresAt})
+				continue
+			}
+			kept = append(kept, msg)
+		}
+		ms.rooms[roomID] = kept
+	}
+	for recipient, queue := range ms.identities {
+		ms.identities[recipient] = slices.DeleteFunc(queue, func(msg DirectMessage) bool {
+			return !msg.ExpiresAt.After(now)
+		})
+	}
+	return expired, nil
+}
+
+func (ms *MemoryStore) TouchRoom(_ context.Context, roomID string) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	ms.activity[roomID] = time.Now()
+	return nil
+}
+
+func (ms *MemoryStore) ClaimRoom(_ context.Context, roomID, owner string) (RoomSettings, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	ms.activity[roomID] = time.Now()
+	settings, ok := ms.settings[roomID]
+	if !ok {
+		settings = RoomSettings{RoomID: roomID, Owner: owner, Policy: PolicyOpen}
+		ms.settings[roomID] = settings
+	}
+	return settings, nil
+}
+
+func (ms *MemoryStore) RoomSettings(_ context.Context, roomID string) (RoomSettings, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	settings, ok := ms.settings[roomID]
+	if !ok {
+		return RoomSettings{}, ErrNotFound
+	}
+	return settings, nil
+}
+
+func (ms *MemoryStore) SaveRoomSettings(_ context.Context, settings RoomSettings) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	if _, ok := ms.settings[settings.RoomID]; !ok {
+		return ErrNotFound
+	}
+	ms.settings[settings.RoomID] = settings
+	return nil
+}
+
+func (ms *MemoryStore) AddInvite(_ context.Context, roomID string, codeHash []byte, expiresAt time.Time) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	ms.invites[string(codeHash)] = memoryInvite{roomID: roomID, expiresAt: expiresAt}
+	return nil
+}
+
+func (ms *MemoryStore) UseInvite(_ context.Context, roomID string, codeHash []byte) (bool, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	invite, ok := ms.invites[string(codeHash)]
+	if !ok || invite.roomID != roomID {
+		return false, nil
+	}
+	delete(ms.invites, string(codeHash))
+	return time.Now().Before(invite.expiresAt), nil
+}
+
+func (ms *MemoryStore) BanFromRoom(_ context.Context, roomID, target string, until time.Time) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	if ms.bans[roomID] == nil {
+		ms.bans[roomID] = make(map[string]time.Time)
+	}
+	ms.bans[roomID][target] = until
+	return nil
+}
+
+func (ms *MemoryStore) Banned(_ context.Context, roomID string, targets ...string) (bool, error) {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+
+	now := time.Now()
+	for _, target := range targets {
+		if until, ok := ms.bans[roomID][target]; ok && target != "" && until.After(now) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (ms *MemoryStore) MarkRead(_ context.Context, roomID string, marker ReadMarker) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	if ms.markers[roomID] == nil {
+		ms.markers[roomID] = make(map[string]ReadMarker)
+	}
+	current, ok := ms.markers[roomID][marker.Member]
+	if ok && current.Seq >= marker.Seq {
+		return nil
+	}
+	marker.UpdatedAt = time.Now().UTC()
+	ms.markers[roomID][marker.Member] = marker
+	return nil
+}
+
+func (ms *MemoryStore) ReadMarkers(_ context.Context, roomID string, limit int) ([]ReadMarker, error) {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+
+	markers := slices.Collect(maps.Values(ms.markers[roomID]))
+	slices.SortFunc(markers, func(a, b ReadMarker) int {
+		return b.UpdatedAt.Compare(a.UpdatedAt)
+	})
+	return markers[:min(limit, len(markers))], nil
+}
+
+func (ms *MemoryStore) SaveIdentity(_ context.Context, fingerprint string, _ []byte) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	if _, ok := ms.identities[fingerprint]; !ok {
+		ms.identities[fingerprint] = nil
+	}
+	return nil
+}
+
+func (ms *MemoryStore) IdentityExists(_ context.Context, fingerprint string) (bool, error) {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+
+	_, ok := ms.identities[fingerprint]
+	return ok, nil
+}
+
+func (ms *MemoryStore) QueueDirect(_ context.Context, msg *DirectMessage, limits DirectLimits) error {
+	now := time.Now()
+	if msg.CreatedAt.IsZero() {
+		msg.CreatedAt = now.UTC()
+	}
+
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	queue, ok := ms.identities[msg.Recipient]
+	if !ok {
+		return ErrNotFound
+	}
+	var queued, fromSender int
+	for _, other := range queue {
+		if other.ExpiresAt.After(now) {
+			queued++
+			if other.Sender == msg.Sender {
+				fromSender++
+			}
+		}
+	}
+	if queued >= limits.Queued || fromSender >= limits.PerSender {
+		return ErrQueueFull
+	}
+	queue = append(queue, *msg)
+	if len(queue) > ms.capacity {
+		queue = queue[len(queue)-ms.capacity:]
+	}
+	ms.identities[msg.Recipient] = queue
+	return nil
+}
+
+func (ms *MemoryStore) DirectMessage(_ context.Context, id string) (DirectMessage, error) {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+
+	for _, queue := range ms.identities {
+		for _, msg := range queue {
+			if msg.ID == id {
+				return msg, nil
+			}
+		}
+	}
+	return DirectMessage{}, ErrNotFound
+}
+
+func (ms *MemoryStore) PendingDirect(_ context.Context, recipient string, limit int) ([]DirectMessage, error) {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+
+	now := time.Now()
+	var pending []DirectMessage
+	for _, msg := range ms.identities[recipient] {
+		if len(pending) == limit {
+			break
+		}
+		if msg.ExpiresAt.After(now) {
+			pending = append(pending, msg)
+		}
+	}
+	return pending, nil
+}
+
+func (ms *MemoryStore) AckDirect(_ context.Context, recipient string, ids []string) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	if queue, ok := ms.identities[recipient]; ok {
+		ms.identities[recipient] = slices.DeleteFunc(queue, func(msg DirectMessage) bool {
+			return slices.Contains(ids, msg.ID)
+		})
+	}
+	return nil
+}
+
+func (ms *MemoryStore) DeleteRoom(_ context.Context, roomID string) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	ms.deleteRoom(roomID)
+	return nil
+}
+
+func (ms *MemoryStore) DeleteIdleRooms(_ context.Context, idle time.Duration) ([]string, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	cutoff := time.Now().Add(-idle)
+	var deleted []string
+	for roomID, last := range ms.activity {
+		if last.Before(cutoff) {
+			ms.deleteRoom(roomID)
+			deleted = append(deleted, roomID)
+		}
+	}
+	return deleted, nil
+}
+
+// CopyRooms writes the settings, invites, bans and read markers of every room
+// to dst. Settings and invites are skipped for rooms dst already gives to
+// another owner, so they never override the persistent owner's choices.
+func (ms *MemoryStore) CopyRooms(ctx context.Context, dst MessageStore) error {
+	ms.mu.RLock()
+	settings := slices.Collect(maps.Values(ms.settings))
+	invites := maps.Clone(ms.invites)
+	bans := make(map[string]map[string]time.Time, len(ms.bans))
+	for roomID, targets := range ms.bans {
+		bans[roomID] = maps.Clone(targets)
+	}
+	markers := make(map[string][]ReadMarker, len(ms.markers))
+	for roomID, members := range ms.markers {
+		markers[roomID] = slices.Collect(maps.Values(members))
+	}
+	ms.mu.RUnlock()
+
+	now := time.Now()
+	for _, room := range settings {
+		claimed, err := dst.ClaimRoom(ctx, room.RoomID, room.Owner)
+		if err != nil {
+			return err
+		}
+		if claimed.Owner == room.Owner {
+			if err := dst.SaveRoomSettings(ctx, room); err != nil {
+				return err
+			}
+			for code, invite := range invites {
+				if invite.roomID != room.RoomID || !invite.expiresAt.After(now) {
+					continue
+				}
+				if err := dst.AddInvite(ctx, room.RoomID, []byte(code), invite.expiresAt); err != nil {
+					return err
+				}
+			}
+		}
+		for target, until := range bans[room.RoomID] {
+			if !until.After(now) {
+				continue
+			}
+			if err := dst.BanFromRoom(ctx, room.RoomID, target, until); err != nil {
+				return err
+			}
+		}
+		for _, marker := range markers[room.RoomID] {
+			if err := dst.MarkRead(ctx, room.RoomID, marker); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (ms *MemoryStore) deleteRoom(roomID string) {
+	delete(ms.rooms, roomID)
+	delete(ms.seqs, roomID)
+	delete(ms.activity, roomID)
+	delete(ms.settings, roomID)
+	delete(ms.bans, roomID)
+	delete(ms.markers, roomID)
+	for code, invite := range ms.invites {
+		if invite.roomID == roomID {
+			delete(ms.invites, code)
+		}
+	}
+}
+
+func (ms *MemoryStore) Close() error {
+	return nil
+}
+
+func isExpired(msg Message, now time.Time) bool {
+	return !msg.ExpiresAt.IsZero() && !msg.ExpiresAt.After(now)
+}
+
+func liveMessages(msgs []Message, now time.Time) []Message {
+	live := make([]Message, 0, len(msgs))
+	for _, msg := range msgs {
+		if !isExpired(msg, now) {
+			live = append(live, msg)
+		}
+	}
+	return live
+}
@@ -1,31 +1,804 @@
 package database
 
 import (
+	"context"
 	"database/sql"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
 	"github.com/fromscript/hush/internal/crypto"
-	"log"
 
-	_ "github.com/lib/pq"
+	"github.com/lib/pq"
 )
 
-var DB *sql.DB
+func Open(dsn string) (*sql.DB, error) {
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		return nil, err
+	}
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return db, nil
+}
+
+// PostgresStore persists room messages in the messages table. Each room has
+// its own data key, wrapped by a KeyProvider and kept in room_keys; message
+// content is sealed with it and bound to its room and message ID.
+type PostgresStore struct {
+	db  *sql.DB
+	kms crypto.KeyProvider
+	// legacy opens rows sealed directly with a master key before room keys
+	// existed. Nil when there are none.
+	legacy *crypto.Keyring
+}
+
+func NewPostgresStore(db *sql.DB, kms crypto.KeyProvider, legacy *crypto.Keyring) *PostgresStore {
+	return &PostgresStore{db: db, kms: kms, legacy: legacy}
+}
+
+// dbtx is satisfied by both *sql.DB and *sql.Tx.
+type dbtx interface {
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+}
+
+// roomKey unwraps the data key of a room, creating one when create is set.
+// Creating must happen in a transaction holding the room row lock.
+func (ps *PostgresStore) roomKey(ctx context.Context, q dbtx, roomID string, create bool) (*crypto.Keyring, error) {
+	var wrapped []byte
+	err := q.QueryRowContext(ctx, "SELECT wrapped_key FROM room_keys WHERE room_id = $1", roomID).Scan(&wrapped)
+	if errors.Is(err, sql.ErrNoRows) {
+		if !create {
+			return nil, ErrNotFound
+		}
+		return ps.createRoomKey(ctx, q, roomID)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	dek, err := ps.kms.UnwrapKey(ctx, wrapped, crypto.RoomKeyAD(roomID))
+	if err != nil {
+		return nil, fmt.Errorf("unwrap key of room %s: %w", roomID, err)
+	}
+	return crypto.NewKeyring(crypto.Key{ID: crypto.RoomKeyID, Material: dek})
+}
+
+func (ps *PostgresStore) createRoomKey(ctx context.Context, q dbtx, roomID string) (*crypto.Keyring, error) {
+	key, wrapped, err := ps.newDataKey(ctx, crypto.RoomKeyAD(roomID))
+	if err != nil {
+		return nil, fmt.Errorf("key of room %s: %w", roomID, err)
+	}
+	if _, err := q.ExecContext(ctx,
+		"INSERT INTO room_keys (room_id, wrapped_key) VALUES ($1, $2)",
+		roomID, wrapped,
+	); err != nil {
+		return nil, err
+	}
+	return crypto.NewKeyring(key)
+}
+
+// newDataKey generates a data key and wraps it for storage.
+func (ps *PostgresStore) newDataKey(ctx context.Context, ad []byte) (crypto.Key, []byte, error) {
+	key, err := crypto.GenerateDataKey()
+	if err != nil {
+		return crypto.Key{}, nil, err
+	}
+	wrapped, err := ps.kms.WrapKey(ctx, key.Material, ad)
+	if err != nil {
+		return crypto.Key{}, nil, fmt.Errorf("wrap: %w", err)
+	}
+	return key, wrapped, nil
+}
+
+// identityKey unwraps the data key sealing an identity's direct messages.
+func (ps *PostgresStore) identityKey(ctx context.Context, fingerprint string) (*crypto.Keyring, error) {
+	var wrapped []byte
+	err := ps.db.QueryRowContext(ctx, "SELECT wrapped_key FROM identities WHERE fingerprint = $1", fingerprint).Scan(&wrapped)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	dek, err := ps.kms.UnwrapKey(ctx, wrapped, crypto.IdentityKeyAD(fingerprint))
+	if err != nil {
+		return nil, fmt.Errorf("unwrap key of identity %s: %w", fingerprint, err)
+	}
+	return crypto.NewKeyring(crypto.Key{ID: crypto.RoomKeyID, Material: dek})
+}
+
+// directAD binds a direct message to its recipient and ID.
+func directAD(recipient, id string) []byte {
+	return crypto.MessageAD("@"+recipient, id)
+}
+
+// roomCipher opens the messages of one room, unwrapping its data key on
+// first use.
+type roomCipher struct {
+	ps     *PostgresStore
+	roomID string
+	keys   *crypto.Keyring
+}
+
+func (rc *roomCipher) open(ctx context.Context, id string, content []byte) ([]byte, error) {
+	keyID, err := crypto.EnvelopeKeyID(content)
+	if err != nil {
+		return nil, err
+	}
+	ad := crypto.MessageAD(rc.roomID, id)
+	if keyID != crypto.RoomKeyID {
+		if rc.ps.legacy == nil {
+			return nil, fmt.Errorf("%w: %d", crypto.ErrUnknownKey, keyID)
+		}
+		return crypto.Open(rc.ps.legacy, content, ad)
+	}
+
+	if rc.keys == nil {
+		if rc.keys, err = rc.ps.roomKey(ctx, rc.ps.db, rc.roomID, false); err != nil {
+			return nil, err
+		}
+	}
+	return crypto.Open(rc.keys, content, ad)
+}
+
+func (ps *PostgresStore) SaveMessage(ctx context.Context, msg *Message) error {
+	tx, err := ps.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// Locks the room row, so concurrent writers get distinct sequences
+	if err := tx.QueryRowContext(ctx,
+		`INSERT INTO rooms (id, last_seq) VALUES ($1, 1)
+		 ON CONFLICT (id) DO UPDATE SET last_seq = rooms.last_seq + 1, last_activity = NOW()
+		 RETURNING last_seq`,
+		msg.RoomID,
+	).Scan(&msg.Seq); err != nil {
+		return fmt.Errorf("assign sequence: %w", err)
+	}
+
+	keys, err := ps.roomKey(ctx, tx, msg.RoomID, true)
+	if err != nil {
+		return err
+	}
+	doubleEncrypted, err := crypto.Seal(keys.Active(), msg.Content, crypto.MessageAD(msg.RoomID, msg.ID))
+	if err != nil {
+		return fmt.Errorf("encrypt message: %w", err)
+	}
+
+	var expiresAt sql.NullTime
+	if !msg.ExpiresAt.IsZero() {
+		expiresAt = sql.NullTime{Time: msg.ExpiresAt, Valid: true}
+	}
+
+	if err := tx.QueryRowContext(ctx,
+		"INSERT INTO messages (id, room_id, seq, author, thread_id, content, expires_at) VALUES ($1, $2, $3, $4, $5, $6, $7) RETURNING created_at",
+		msg.ID, msg.RoomID, msg.Seq, msg.Author, sql.NullString{String: msg.ThreadID, Valid: msg.ThreadID != ""}, doubleEncrypted, expiresAt,
+	).Scan(&msg.CreatedAt); err != nil {
+		return fmt.Errorf("insert message: %w", err)
+	}
+
+	return tx.Commit()
+}
 
-func InitDB() {
-	var err error
-	connStr := "user=wisper_user dbname=wisper password=supersecret sslmode=disable"
-	DB, err = sql.Open("postgres", connStr)
+func (ps *PostgresStore) Message(ctx context.Context, roomID, id string) (Message, error) {
+	msg := Message{ID: id, RoomID: roomID}
+	var (
+		content   []byte
+		expiresAt sql.NullTime
+	)
+	err := ps.db.QueryRowContext(ctx,
+		`SELECT seq, COALESCE(author, ''), COALESCE(thread_id, ''), content, created_at, expires_at FROM messages
+		 WHERE room_id = $1 AND id = $2
+		   AND (expires_at IS NULL OR expires_at > NOW())`,
+		roomID, id,
+	).Scan(&msg.Seq, &msg.Author, &msg.ThreadID, &content, &msg.CreatedAt, &expiresAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Message{}, ErrNotFound
+	}
 	if err != nil {
-		log.Fatal(err)
+		return Message{}, err
 	}
+	msg.ExpiresAt = expiresAt.Time
+
+	rc := roomCipher{ps: ps, roomID: roomID}
+	if msg.Content, err = rc.open(ctx, msg.ID, content); err != nil {
+		return Message{}, fmt.Errorf("decrypt message %s: %w", msg.ID, err)
+	}
+	return msg, nil
 }
 
-func SaveMessage(encryptedMsg []byte) {
-	// Encrypt message with server master key before storage
-	masterKey := []byte("demo_master_key") // Load from secure source in production
-	doubleEncrypted, _ := crypto.Encrypt(encryptedMsg, masterKey)
+// UpdateMessage locks the room row, like SaveMessage, so the room key can be
+// created if the message still predates it.
+func (ps *PostgresStore) UpdateMessage(ctx context.Context, roomID, id string, update func(*Message) error) error {
+	tx, err := ps.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, "SELECT 1 FROM rooms WHERE id = $1 FOR UPDATE", roomID); err != nil {
+		return err
+	}
+	msg := Message{ID: id, RoomID: roomID}
+	var (
+		content   []byte
+		expiresAt sql.NullTime
+	)
+	err = tx.QueryRowContext(ctx,
+		`SELECT seq, COALESCE(author, ''), COALESCE(thread_id, ''), content, created_at, expires_at FROM messages
+		 WHERE room_id = $1 AND id = $2
+		   AND (expires_at IS NULL OR expires_at > NOW())`,
+		roomID, id,
+	).Scan(&msg.Seq, &msg.Author, &msg.ThreadID, &content, &msg.CreatedAt, &expiresAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrNotFound
+	}
+	if err != nil {
+		return err
+	}
+	msg.ExpiresAt = expiresAt.Time
+
+	rc := roomCipher{ps: ps, roomID: roomID}
+	if msg.Content, err = rc.open(ctx, id, content); err != nil {
+		return fmt.Errorf("decrypt message %s: %w", id, err)
+	}
+	if err := update(&msg); err != nil {
+		return err
+	}
 
-	_, err := DB.Exec("INSERT INTO messages (content) VALUES ($1)", doubleEncrypted)
+	keys, err := ps.roomKey(ctx, tx, roomID, true)
+	if err != nil {
+		return err
+	}
+	sealed, err := crypto.Seal(keys.Active(), msg.Content, crypto.MessageAD(roomID, id))
 	if err != nil {
-		log.Printf("Failed to save message: %v", err)
+		return fmt.Errorf("encrypt message: %w", err)
 	}
+	if _, err := tx.ExecContext(ctx,
+		"UPDATE messages SET content = $1 WHERE room_id = $2 AND id = $3",
+		sealed, roomID, id,
+	); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (ps *PostgresStore) DeleteMessage(ctx context.Context, roomID, id string) error {
+	res, err := ps.db.ExecContext(ctx, "DELETE FROM messages WHERE room_id = $1 AND id = $2", roomID, id)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (ps *PostgresStore) History(ctx context.Context, roomID string, q HistoryQuery) ([]Message, error) {
+	var (
+		rows *sql.Rows
+		err  error
+	)
+	if q.Since > 0 {
+		rows, err = ps.db.QueryContext(ctx,
+			`SELECT id, seq, content, created_at, expires_at FROM messages
+			 WHERE room_id = $1 AND seq > $2
+			   AND (expires_at IS NULL OR expires_at > NOW())
+			   AND ($4 = '' OR thread_id = $4 OR id::text = $4)
+			 ORDER BY seq ASC LIMIT $3`,
+			roomID, q.Since, q.Limit, q.ThreadID,
+		)
+	} else {
+		rows, err = ps.db.QueryContext(ctx,
+			`SELECT id, seq, content, created_at, expires_at FROM messages
+			 WHERE room_id = $1 AND ($2 = 0 OR seq < $2)
+			   AND (expires_at IS NULL OR expires_at > NOW())
+			   AND ($4 = '' OR thread_id = $4 OR id::text = $4)
+			 ORDER BY seq DESC LIMIT $3`,
+			roomID, q.Before, q.Limit, q.ThreadID,
+		)
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	rc := roomCipher{ps: ps, roomID: roomID}
+	var msgs []Message
+	for rows.Next() {
+		msg := Message{RoomID: roomID}
+		var (
+			content   []byte
+			expiresAt sql.NullTime
+		)
+		if err := rows.Scan(&msg.ID, &msg.Seq, &content, &msg.CreatedAt, &expiresAt); err != nil {
+			return nil, err
+		}
+		msg.ExpiresAt = expiresAt.Time
+		if msg.Content, err = rc.open(ctx, msg.ID, content); err != nil {
+			return nil, fmt.Errorf("decrypt message %s: %w", msg.ID, err)
+		}
+		msgs = append(msgs, msg)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if q.Since == 0 {
+		slices.Reverse(msgs)
+	}
+	return msgs, nil
+}
+
+func (ps *PostgresStore) DeleteExpired(ctx context.Context, now time.Time) ([]Message, error) {
+	if _, err := ps.db.ExecContext(ctx, "DELETE FROM direct_messages WHERE expires_at <= $1", now); err != nil {
+		return nil, err
+	}
+
+	rows, err := ps.db.QueryContext(ctx,
+		"DELETE FROM messages WHERE expires_at <= $1 RETURNING id, room_id, seq, expires_at",
+		now,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var expired []Message
+	for rows.Next() {
+		var msg Message
+		if err := rows.Scan(&msg.ID, &msg.RoomID, &msg.Seq, &msg.ExpiresAt); err != nil {
+			return nil, err
+		}
+		expired = append(expired, msg)
+	}
+	return expired, rows.Err()
+}
+
+func (ps *PostgresStore) TouchRoom(ctx context.Context, roomID string) error {
+	_, err := ps.db.ExecContext(ctx,
+		"INSERT INTO rooms (id) VALUES ($1) ON CONFLICT (id) DO UPDATE SET last_activity = NOW()",
+		roomID,
+	)
+	return err
+}
+
+func (ps *PostgresStore) ClaimRoom(ctx context.Context, roomID, owner string) (RoomSettings, error) {
+	settings := RoomSettings{RoomID: roomID}
+	var storedOwner sql.NullString
+	err := ps.db.QueryRowContext(ctx,
+		`INSERT INTO rooms (id, owner) VALUES ($1, $2)
+		 ON CONFLICT (id) DO UPDATE SET owner = COALESCE(rooms.owner, EXCLUDED.owner), last_activity = NOW()
+		 RETURNING owner, join_policy, password_hash, max_members, locked`,
+		roomID, owner,
+	).Scan(&storedOwner, &settings.Policy, &settings.PasswordHash, &settings.MaxMembers, &settings.Locked)
+	settings.Owner = storedOwner.String
+	return settings, err
+}
+
+func (ps *PostgresStore) RoomSettings(ctx context.Context, roomID string) (RoomSettings, error) {
+	settings := RoomSettings{RoomID: roomID}
+	var storedOwner sql.NullString
+	err := ps.db.QueryRowContext(ctx,
+		"SELECT owner, join_policy, password_hash, max_members, locked FROM rooms WHERE id = $1",
+		roomID,
+	).Scan(&storedOwner, &settings.Policy, &settings.PasswordHash, &settings.MaxMembers, &settings.Locked)
+	if errors.Is(err, sql.ErrNoRows) {
+		return RoomSettings{}, ErrNotFound
+	}
+	settings.Owner = storedOwner.String
+	return settings, err
+}
+
+func (ps *PostgresStore) SaveRoomSettings(ctx context.Context, settings RoomSettings) error {
+	res, err := ps.db.ExecContext(ctx,
+		"UPDATE rooms SET join_policy = $2, password_hash = $3, max_members = $4, locked = $5 WHERE id = $1",
+		settings.RoomID, settings.Policy, settings.PasswordHash, settings.MaxMembers, settings.Locked,
+	)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (ps *PostgresStore) AddInvite(ctx context.Context, roomID string, codeHash []byte, expiresAt time.Time) error {
+	_, err := ps.db.ExecContext(ctx,
+		"INSERT INTO room_invites (code_hash, room_id, expires_at) VALUES ($1, $2, $3) ON CONFLICT (code_hash) DO NOTHING",
+		codeHash, roomID, expiresAt,
+	)
+	return err
+}
+
+func (ps *PostgresStore) UseInvite(ctx context.Context, roomID string, codeHash []byte) (bool, error) {
+	var valid bool
+	err := ps.db.QueryRowContext(ctx,
+		"DELETE FROM room_invites WHERE code_hash = $1 AND room_id = $2 RETURNING expires_at > NOW()",
+		codeHash, roomID,
+	).Scan(&valid)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	return valid, err
+}
+
+func (ps *PostgresStore) BanFromRoom(ctx context.Context, roomID, target string, until time.Time) error {
+	_, err := ps.db.ExecContext(ctx,
+		`INSERT INTO room_bans (room_id, target, expires_at) VALUES ($1, $2, $3)
+		 ON CONFLICT (room_id, target) DO UPDATE SET expires_at = EXCLUDED.expires_at`,
+		roomID, target, until,
+	)
+	return err
+}
+
+func (ps *PostgresStore) Banned(ctx context.Context, roomID string, targets ...string) (bool, error) {
+	var banned bool
+	err := ps.db.QueryRowContext(ctx,
+		`SELECT EXISTS (
+		   SELECT 1 FROM room_bans
+		   WHERE room_id = $1 AND target = ANY($2) AND target <> '' AND expires_at > NOW()
+		 )`,
+		roomID, pq.Array(targets),
+	).Scan(&banned)
+	return banned, err
+}
+
+func (ps *PostgresStore) MarkRead(ctx context.Context, roomID string, marker ReadMarker) error {
+	_, err := ps.db.ExecContext(ctx,
+		`INSERT INTO read_markers (room_id, member, reader, seq) VALUES ($1, $2, $3, $4)
+		 ON CONFLICT (room_id, member) DO UPDATE
+		 SET reader = EXCLUDED.reader, seq = EXCLUDED.seq, updated_at = NOW()
+		 WHERE read_markers.seq < EXCLUDED.seq`,
+		roomID, marker.Member, marker.Reader, marker.Seq,
+	)
+	return err
+}
+
+func (ps *PostgresStore) ReadMarkers(ctx context.Context, roomID string, limit int) ([]ReadMarker, error) {
+	rows, err := ps.db.QueryContext(ctx,
+		`SELECT member, reader, seq, updated_at FROM read_markers
+		 WHERE room_id = $1 ORDER BY updated_at DESC LIMIT $2`,
+		roomID, limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var markers []ReadMarker
+	for rows.Next() {
+		var marker ReadMarker
+		if err := rows.Scan(&marker.Member, &marker.Reader, &marker.Seq, &marker.UpdatedAt); err != nil {
+			return nil, err
+		}
+		markers = append(markers, marker)
+	}
+	return markers, rows.Err()
+}
+
+// SaveIdentity gives a new identity its own data key, so its queued direct
+// messages can be shredded with it, and otherwise records that it was seen.
+func (ps *PostgresStore) SaveIdentity(ctx context.Context, fingerprint string, publicKey []byte) error {
+	res, err := ps.db.ExecContext(ctx, "UPDATE identities SET last_seen = NOW() WHERE fingerprint = $1", fingerprint)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err == nil && n > 0 {
+		return nil
+	}
+
+	_, wrapped, err := ps.newDataKey(ctx, crypto.IdentityKeyAD(fingerprint))
+	if err != nil {
+		return fmt.Errorf("key of identity %s: %w", fingerprint, err)
+	}
+	_, err = ps.db.ExecContext(ctx,
+		`INSERT INTO identities (fingerprint, public_key, wrapped_key) VALUES ($1, $2, $3)
+		 ON CONFLICT (fingerprint) DO UPDATE SET last_seen = NOW()`,
+		fingerprint, publicKey, wrapped,
+	)
+	return err
+}
+
+func (ps *PostgresStore) IdentityExists(ctx context.Context, fingerprint string) (bool, error) {
+	var exists bool
+	err := ps.db.QueryRowContext(ctx,
+		"SELECT EXISTS (SELECT 1 FROM identities WHERE fingerprint = $1)",
+		fingerprint,
+	).Scan(&exists)
+	return exists, err
+}
+
+func (ps *PostgresStore) QueueDirect(ctx context.Context, msg *DirectMessage, limits DirectLimits) error {
+	keys, err := ps.identityKey(ctx, msg.Recipient)
+	if err != nil {
+		return err
+	}
+	sealed, err := crypto.Seal(keys.Active(), msg.Content, directAD(msg.Recipient, msg.ID))
+	if err != nil {
+		return fmt.Errorf("encrypt direct message: %w", err)
+	}
+
+	tx, err := ps.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// Serializes senders to one recipient, so they cannot overrun its limits
+	// together
+	if _, err := tx.ExecContext(ctx, "SELECT pg_advisory_xact_lock(hashtext('direct ' || $1))", msg.Recipient); err != nil {
+		return err
+	}
+	var queued, fromSender int
+	if err := tx.QueryRowContext(ctx,
+		`SELECT COUNT(*), COUNT(*) FILTER (WHERE sender = $2) FROM direct_messages
+		 WHERE recipient = $1 AND expires_at > NOW()`,
+		msg.Recipient, msg.Sender,
+	).Scan(&queued, &fromSender); err != nil {
+		return err
+	}
+	if queued >= limits.Queued || fromSender >= limits.PerSender {
+		return ErrQueueFull
+	}
+
+	if err := tx.QueryRowContext(ctx,
+		"INSERT INTO direct_messages (id, recipient, sender, content, expires_at) VALUES ($1, $2, $3, $4, $5) RETURNING created_at",
+		msg.ID, msg.Recipient, msg.Sender, sealed, msg.ExpiresAt,
+	).Scan(&msg.CreatedAt); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (ps *PostgresStore) DirectMessage(ctx context.Context, id string) (DirectMessage, error) {
+	msg := DirectMessage{ID: id}
+	var content []byte
+	err := ps.db.QueryRowContext(ctx,
+		"SELECT recipient, content, created_at, expires_at FROM direct_messages WHERE id = $1 AND expires_at > NOW()",
+		id,
+	).Scan(&msg.Recipient, &content, &msg.CreatedAt, &msg.ExpiresAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return DirectMessage{}, ErrNotFound
+	}
+	if err != nil {
+		return DirectMessage{}, err
+	}
+
+	keys, err := ps.identityKey(ctx, msg.Recipient)
+	if err != nil {
+		return DirectMessage{}, err
+	}
+	if msg.Content, err = crypto.Open(keys, content, directAD(msg.Recipient, id)); err != nil {
+		return DirectMessage{}, fmt.Errorf("decrypt direct message %s: %w", id, err)
+	}
+	return msg, nil
+}
+
+func (ps *PostgresStore) PendingDirect(ctx context.Context, recipient string, limit int) ([]DirectMessage, error) {
+	rows, err := ps.db.QueryContext(ctx,
+		`SELECT id, content, created_at, expires_at FROM direct_messages
+		 WHERE recipient = $1 AND expires_at > NOW()
+		 ORDER BY created_at, id LIMIT $2`,
+		recipient, limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var (
+		keys    *crypto.Keyring
+		pending []DirectMessage
+	)
+	for rows.Next() {
+		msg := DirectMessage{Recipient: recipient}
+		var content []byte
+		if err := rows.Scan(&msg.ID, &content, &msg.CreatedAt, &msg.ExpiresAt); err != nil {
+			return nil, err
+		}
+		if keys == nil {
+			if keys, err = ps.identityKey(ctx, recipient); err != nil {
+				return nil, err
+			}
+		}
+		if msg.Content, err = crypto.Open(keys, content, directAD(recipient, msg.ID)); err != nil {
+			return nil, fmt.Errorf("decrypt direct message %s: %w", msg.ID, err)
+		}
+		pending = append(pending, msg)
+	}
+	return pending, rows.Err()
+}
+
+func (ps *PostgresStore) AckDirect(ctx context.Context, recipient string, ids []string) error {
+	_, err := ps.db.ExecContext(ctx,
+		"DELETE FROM direct_messages WHERE recipient = $1 AND id::text = ANY($2)",
+		recipient, pq.Array(ids),
+	)
+	return err
+}
+
+// DeleteRoom removes the room in one statement; its data key, messages and
+// access rows go with it through ON DELETE CASCADE.
+func (ps *PostgresStore) DeleteRoom(ctx context.Context, roomID string) error {
+	_, err := ps.db.ExecContext(ctx, "DELETE FROM rooms WHERE id = $1", roomID)
+	return err
+}
+
+func (ps *PostgresStore) DeleteIdleRooms(ctx context.Context, idle time.Duration) ([]string, error) {
+	rows, err := ps.db.QueryContext(ctx,
+		"DELETE FROM rooms WHERE last_activity < NOW() - make_interval(secs => $1) RETURNING id",
+		idle.Seconds(),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var deleted []string
+	for rows.Next() {
+		var roomID string
+		if err := rows.Scan(&roomID); err != nil {
+			return nil, err
+		}
+		deleted = append(deleted, roomID)
+	}
+	return deleted, rows.Err()
+}
+
+// Reencrypt moves up to limit messages still sealed with a master key to
+// their room's data key and reports how many it rewrote. Call it until it
+// returns zero.
+func (ps *PostgresStore) Reencrypt(ctx context.Context, limit int) (int, error) {
+	tx, err := ps.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	// Bytes 2-5 of an envelope hold its key ID
+	rows, err := tx.QueryContext(ctx,
+		`SELECT id, room_id, content FROM messages
+		 WHERE substring(content from 2 for 4) <> $1
+		 ORDER BY room_id, seq LIMIT $2
+		 FOR UPDATE SKIP LOCKED`,
+		binary.BigEndian.AppendUint32(nil, crypto.RoomKeyID), limit,
+	)
+	if err != nil {
+		return 0, err
+	}
+
+	var batch []Message
+	for rows.Next() {
+		var msg Message
+		if err := rows.Scan(&msg.ID, &msg.RoomID, &msg.Content); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		batch = append(batch, msg)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+	if len(batch) > 0 && ps.legacy == nil {
+		return 0, errors.New("messages sealed with a master key need the master keyring")
+	}
+
+	roomKeys := make(map[string]*crypto.Keyring)
+	for _, msg := range batch {
+		keys, ok := roomKeys[msg.RoomID]
+		if !ok {
+			// Rows of one room are locked by this transaction
+			if _, err := tx.ExecContext(ctx, "SELECT 1 FROM rooms WHERE id = $1 FOR UPDATE", msg.RoomID); err != nil {
+				return 0, err
+			}
+			if keys, err = ps.roomKey(ctx, tx, msg.RoomID, true); err != nil {
+				return 0, err
+			}
+			roomKeys[msg.RoomID] = keys
+		}
+
+		ad := crypto.MessageAD(msg.RoomID, msg.ID)
+		plaintext, err := crypto.Open(ps.legacy, msg.Content, ad)
+		if err != nil {
+			return 0, fmt.Errorf("decrypt message %s: %w", msg.ID, err)
+		}
+		sealed, err := crypto.Seal(keys.Active(), plaintext, ad)
+		if err != nil {
+			return 0, fmt.Errorf("encrypt message %s: %w", msg.ID, err)
+		}
+		if _, err := tx.ExecContext(ctx,
+			"UPDATE messages SET content = $1 WHERE room_id = $2 AND id = $3",
+			sealed, msg.RoomID, msg.ID,
+		); err != nil {
+			return 0, err
+		}
+	}
+
+	return len(batch), tx.Commit()
+}
+
+// RewrapRoomKeys wraps up to limit room data keys after the given room ID
+// again, so they move to the key provider's current key-encryption key. It
+// returns the room ID to continue after, or "" when all keys are done.
+func (ps *PostgresStore) RewrapRoomKeys(ctx context.Context, after string, limit int) (string, error) {
+	return ps.rewrapKeys(ctx, "room_keys", "room_id", crypto.RoomKeyAD, after, limit)
+}
+
+// RewrapIdentityKeys is RewrapRoomKeys for the data keys of identities.
+func (ps *PostgresStore) RewrapIdentityKeys(ctx context.Context, after string, limit int) (string, error) {
+	return ps.rewrapKeys(ctx, "identities", "fingerprint", crypto.IdentityKeyAD, after, limit)
+}
+
+// rewrapKeys rewraps the wrapped_key column of table, keyed by column.
+func (ps *PostgresStore) rewrapKeys(ctx context.Context, table, column string, adFor func(string) []byte, after string, limit int) (string, error) {
+	tx, err := ps.db.BeginTx(ctx, nil)
+	if err != nil {
+		return "", err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(ctx,
+		fmt.Sprintf("SELECT %[2]s, wrapped_key FROM %[1]s WHERE %[2]s > $1 ORDER BY %[2]s LIMIT $2 FOR UPDATE", table, column),
+		after, limit,
+	)
+	if err != nil {
+		return "", err
+	}
+
+	type wrappedKey struct {
+		owner   string
+		wrapped []byte
+	}
+	var batch []wrappedKey
+	for rows.Next() {
+		var wk wrappedKey
+		if err := rows.Scan(&wk.owner, &wk.wrapped); err != nil {
+			rows.Close()
+			return "", err
+		}
+		batch = append(batch, wk)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return "", err
+	}
+	if len(batch) == 0 {
+		return "", nil
+	}
+
+	for _, wk := range batch {
+		ad := adFor(wk.owner)
+		dek, err := ps.kms.UnwrapKey(ctx, wk.wrapped, ad)
+		if err != nil {
+			return "", fmt.Errorf("unwrap key of %s: %w", wk.owner, err)
+		}
+		wrapped, err := ps.kms.WrapKey(ctx, dek, ad)
+		if err != nil {
+			return "", fmt.Errorf("wrap key of %s: %w", wk.owner, err)
+		}
+		if _, err := tx.ExecContext(ctx,
+			fmt.Sprintf("UPDATE %s SET wrapped_key = $1 WHERE %s = $2", table, column),
+			wrapped, wk.owner,
+		); err != nil {
+			return "", err
+		}
+	}
+
+	return batch[len(batch)-1].owner, tx.Commit()
+}
+
+func (ps *PostgresStore) Close() error {
+	return ps.db.Close()
 }
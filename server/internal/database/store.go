@@ -0,0 +1,150 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+var (
+	ErrNotFound  = errors.New("not found")
+	ErrQueueFull = errors.New("direct message queue is full")
+)
+
+// Message is a single persisted room frame. Content is opaque to the store:
+// it holds whatever the websocket layer hands over (the client ciphertext
+// wrapped in its JSON frame). Seq is assigned by the store on save and
+// increases monotonically within a room. A zero ExpiresAt never expires.
+// Author is the identity fingerprint or session that sent the message; it is
+// kept server-side to decide who may change the message.
+type Message struct {
+	ID        string
+	RoomID    string
+	Seq       int64
+	Author    string
+	ThreadID  string // ID of the thread's first message, empty outside threads
+	Content   []byte
+	CreatedAt time.Time
+	ExpiresAt time.Time
+}
+
+// DirectMessage is a direct message queued for an identity until it is
+// acknowledged. Like Message.Content, Content is opaque to the store.
+type DirectMessage struct {
+	ID        string
+	Recipient string // identity key fingerprint
+	Sender    string // identity fingerprint or session that sent it
+	Content   []byte
+	CreatedAt time.Time
+	ExpiresAt time.Time
+}
+
+// DirectLimits caps a recipient's queue: at most Queued unexpired messages in
+// total, and at most PerSender of them from any one sender.
+type DirectLimits struct {
+	Queued    int
+	PerSender int
+}
+
+// ReadMarker records how far a member has read a room. Member identifies the
+// member (identity fingerprint, or per-room member ID of a resumable session);
+// Reader is how other members are shown it.
+type ReadMarker struct {
+	Member    string
+	Reader    string
+	Seq       int64
+	UpdatedAt time.Time
+}
+
+// HistoryQuery selects a page of a room's history. With Since set, the page
+// starts right after that sequence and moves forward; otherwise it ends right
+// before Before (or at the newest message when Before is zero) and moves back.
+// Results are always returned in ascending sequence order. ThreadID limits
+// the page to one thread: its first message and the replies to it.
+type HistoryQuery struct {
+	Since    int64
+	Before   int64
+	Limit    int
+	ThreadID string
+}
+
+// Room join policies.
+const (
+	PolicyOpen     = "open"
+	PolicyPassword = "password"
+	PolicyInvite   = "invite"
+)
+
+// RoomSettings controls who may join a room. Owner is the identity
+// fingerprint, or without one the session ID, of whoever created the room.
+// PasswordHash is a digest of the client-side password hash, never the hash
+// itself. Zero MaxMembers means no limit. A locked room admits nobody new.
+type RoomSettings struct {
+	RoomID       string
+	Owner        string
+	Policy       string
+	PasswordHash []byte
+	MaxMembers   int
+	Locked       bool
+}
+
+type MessageStore interface {
+	SaveMessage(ctx context.Context, msg *Message) error
+	// Message returns a single message of a room, or ErrNotFound.
+	Message(ctx context.Context, roomID, id string) (Message, error)
+	History(ctx context.Context, roomID string, q HistoryQuery) ([]Message, error)
+	// UpdateMessage runs update on a stored message and saves its new
+	// content, atomically with respect to other updates. An error from
+	// update aborts the change and is returned as is.
+	UpdateMessage(ctx context.Context, roomID, id string, update func(*Message) error) error
+	// DeleteMessage removes a single message, or returns ErrNotFound.
+	DeleteMessage(ctx context.Context, roomID, id string) error
+	// DeleteExpired removes every message whose ExpiresAt is not after now and
+	// returns them without content, so their rooms can be told. Expired direct
+	// messages are dropped as well.
+	DeleteExpired(ctx context.Context, now time.Time) ([]Message, error)
+	// TouchRoom records activity in a room, creating it if needed.
+	TouchRoom(ctx context.Context, roomID string) error
+	// ClaimRoom returns the settings of a room, creating it as an open room
+	// owned by owner if it has none yet.
+	ClaimRoom(ctx context.Context, roomID, owner string) (RoomSettings, error)
+	// RoomSettings returns the settings of a room without claiming it, or
+	// ErrNotFound.
+	RoomSettings(ctx context.Context, roomID string) (RoomSettings, error)
+	SaveRoomSettings(ctx context.Context, settings RoomSettings) error
+	// AddInvite stores a single-use invite, identified by a digest of its code.
+	AddInvite(ctx context.Context, roomID string, codeHash []byte, expiresAt time.Time) error
+	// UseInvite consumes an invite and reports whether it was valid.
+	UseInvite(ctx context.Context, roomID string, codeHash []byte) (bool, error)
+	// BanFromRoom bans a session ID or key fingerprint from a room until the
+	// given time.
+	BanFromRoom(ctx context.Context, roomID, target string, until time.Time) error
+	// Banned reports whether any of targets is currently banned from a room.
+	Banned(ctx context.Context, roomID string, targets ...string) (bool, error)
+	// MarkRead moves a member's read marker forward to seq; it never moves
+	// back.
+	MarkRead(ctx context.Context, roomID string, marker ReadMarker) error
+	// ReadMarkers returns up to limit markers of a room, most recently
+	// updated first.
+	ReadMarkers(ctx context.Context, roomID string, limit int) ([]ReadMarker, error)
+	// SaveIdentity records an identity key, so direct messages can be queued
+	// for it while it is offline.
+	SaveIdentity(ctx context.Context, fingerprint string, publicKey []byte) error
+	IdentityExists(ctx context.Context, fingerprint string) (bool, error)
+	// QueueDirect stores a direct message for a saved identity, or returns
+	// ErrQueueFull if that would exceed limits.
+	QueueDirect(ctx context.Context, msg *DirectMessage, limits DirectLimits) error
+	// DirectMessage returns a single queued direct message, or ErrNotFound.
+	DirectMessage(ctx context.Context, id string) (DirectMessage, error)
+	// PendingDirect returns up to limit queued messages for recipient, oldest
+	// first.
+	PendingDirect(ctx context.Context, recipient string, limit int) ([]DirectMessage, error)
+	// AckDirect removes delivered messages from the recipient's queue.
+	AckDirect(ctx context.Context, recipient string, ids []string) error
+	// DeleteRoom removes a room together with all of its messages.
+	DeleteRoom(ctx context.Context, roomID string) error
+	// DeleteIdleRooms removes every room without activity for longer than idle
+	// and returns their IDs.
+	DeleteIdleRooms(ctx context.Context, idle time.Duration) ([]string, error)
+	Close() error
+}
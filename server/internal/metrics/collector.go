@@ -1,9 +1,6 @@
 package metrics
 
-import (
-	"log/slog"
-	"time"
-)
+import "time"
 
 type Collector interface {
 	IncrementConnection()
@@ -15,41 +12,22 @@ type Collector interface {
 	RecordLatency(duration time.Duration)
 	RecordPing(s string)
 	RecordPong(s string)
+	RecordSlowConsumer(policy string)
+	SetRoomCount(n int)
 }
 
+// DefaultCollector discards everything; it is what the manager uses unless
+// a collector is configured.
 type DefaultCollector struct{}
 
-func (mc *DefaultCollector) IncrementConnection() {
-	slog.Info("New connection established")
-}
-
-func (mc *DefaultCollector) DecrementConnection() {
-	slog.Info("Connection closed")
-}
-
-func (mc *DefaultCollector) RecordMessageReceived() {
-	slog.Info("New message received")
-}
-
-func (mc *DefaultCollector) RecordMessageSent() {
-	slog.Info("New message sent")
-}
-
-func (mc *DefaultCollector) RecordAuthFailure() {
-	slog.Info("Authentication failure")
-}
-
-func (mc *DefaultCollector) RecordUpgradeFailure() {
-	slog.Info("Upgrade failure")
-}
-func (mc *DefaultCollector) RecordPing(s string) {
-	slog.Info("New ping", s)
-}
-
-func (mc *DefaultCollector) RecordPong(s string) {
-	slog.Info("New pong", s)
-}
-
-func (mc *DefaultCollector) RecordLatency(duration time.Duration) {
-	slog.Info("New latency", duration)
-}
+func (mc *DefaultCollector) IncrementConnection()        {}
+func (mc *DefaultCollector) DecrementConnection()        {}
+func (mc *DefaultCollector) RecordMessageReceived()      {}
+func (mc *DefaultCollector) RecordMessageSent()          {}
+func (mc *DefaultCollector) RecordAuthFailure()          {}
+func (mc *DefaultCollector) RecordUpgradeFailure()       {}
+func (mc *DefaultCollector) RecordLatency(time.Duration) {}
+func (mc *DefaultCollector) RecordPing(string)           {}
+func (mc *DefaultCollector) RecordPong(string)           {}
+func (mc *DefaultCollector) RecordSlowConsumer(string)   {}
+func (mc *DefaultCollector) SetRoomCount(int)            {}
@@ -0,0 +1,198 @@
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Ping round trips, in seconds
+var latencyBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// PrometheusCollector keeps counters, gauges and histograms in memory and
+// serves them in the Prometheus text exposition format.
+type PrometheusCollector struct {
+	connections      atomic.Int64
+	connectionsTotal atomic.Uint64
+	messagesIn       atomic.Uint64
+	messagesOut      atomic.Uint64
+	authFailures     atomic.Uint64
+	upgradeFailures  atomic.Uint64
+	pings            atomic.Uint64
+	pongs            atomic.Uint64
+	rooms            atomic.Int64
+
+	slowMu        sync.Mutex
+	slowConsumers map[string]uint64 // policy -> count
+
+	latency *histogram
+}
+
+func NewPrometheusCollector() *PrometheusCollector {
+	return &PrometheusCollector{
+		slowConsumers: make(map[string]uint64),
+		latency:       newHistogram(latencyBuckets),
+	}
+}
+
+func (pc *PrometheusCollector) IncrementConnection() {
+	pc.connections.Add(1)
+	pc.connectionsTotal.Add(1)
+}
+
+func (pc *PrometheusCollector) DecrementConnection() {
+	pc.connections.Add(-1)
+}
+
+func (pc *PrometheusCollector) RecordMessageReceived() {
+	pc.messagesIn.Add(1)
+}
+
+func (pc *PrometheusCollector) RecordMessageSent() {
+	pc.messagesOut.Add(1)
+}
+
+func (pc *PrometheusCollector) RecordAuthFailure() {
+	pc.authFailures.Add(1)
+}
+
+func (pc *PrometheusCollector) RecordUpgradeFailure() {
+	pc.upgradeFailures.Add(1)
+}
+
+func (pc *PrometheusCollector) RecordLatency(duration time.Duration) {
+	pc.latency.observe(duration.Seconds())
+}
+
+func (pc *PrometheusCollector) RecordPing(string) {
+	pc.pings.Add(1)
+}
+
+func (pc *PrometheusCollector) RecordPong(string) {
+	pc.pongs.Add(1)
+}
+
+func (pc *PrometheusCollector) RecordSlowConsumer(policy string) {
+	pc.slowMu.Lock()
+	defer pc.slowMu.Unlock()
+	pc.slowConsumers[policy]++
+}
+
+func (pc *PrometheusCollector) SetRoomCount(n int) {
+	pc.rooms.Store(int64(n))
+}
+
+func (pc *PrometheusCollector) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	pc.WriteTo(w)
+}
+
+// WriteTo writes every metric in the Prometheus text exposition format.
+func (pc *PrometheusCollector) WriteTo(w io.Writer) (int64, error) {
+	ew := &errWriter{w: w}
+
+	ew.metric("hush_connections", "gauge", "Currently open WebSocket connections.", pc.connections.Load())
+	ew.metric("hush_connections_total", "counter", "WebSocket connections accepted.", pc.connectionsTotal.Load())
+	ew.metric("hush_messages_received_total", "counter", "Frames received from clients.", pc.messagesIn.Load())
+	ew.metric("hush_messages_sent_total", "counter", "Frames written to clients.", pc.messagesOut.Load())
+	ew.metric("hush_auth_failures_total", "counter", "Connections rejected for an invalid token.", pc.authFailures.Load())
+	ew.metric("hush_upgrade_failures_total", "counter", "Failed WebSocket upgrades.", pc.upgradeFailures.Load())
+	ew.metric("hush_pings_total", "counter", "Pings sent to clients.", pc.pings.Load())
+	ew.metric("hush_pongs_total", "counter", "Pongs received from clients.", pc.pongs.Load())
+	ew.metric("hush_rooms", "gauge", "Rooms held in memory.", pc.rooms.Load())
+
+	ew.header("hush_slow_consumers_total", "counter", "Deliveries to a full client queue, by policy applied.")
+	pc.slowMu.Lock()
+	policies := make([]string, 0, len(pc.slowConsumers))
+	for policy := range pc.slowConsumers {
+		policies = append(policies, policy)
+	}
+	sort.Strings(policies)
+	for _, policy := range policies {
+		ew.printf("hush_slow_consumers_total{policy=%q} %d\n", policy, pc.slowConsumers[policy])
+	}
+	pc.slowMu.Unlock()
+
+	ew.header("hush_ping_rtt_seconds", "histogram", "Ping round trip time.")
+	pc.latency.writeTo(ew, "hush_ping_rtt_seconds")
+
+	return ew.n, ew.err
+}
+
+type histogram struct {
+	mu      sync.Mutex
+	buckets []float64
+	counts  []uint64 // per bucket, not cumulative
+	sum     float64
+	count   uint64
+}
+
+func newHistogram(buckets []float64) *histogram {
+	return &histogram{
+		buckets: buckets,
+		counts:  make([]uint64, len(buckets)),
+	}
+}
+
+func (h *histogram) observe(v float64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if i := sort.SearchFloat64s(h.buckets, v); i < len(h.buckets) {
+		h.counts[i]++
+	}
+	h.sum += v
+	h.count++
+}
+
+func (h *histogram) writeTo(ew *errWriter, name string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	var cumulative uint64
+	for i, bound := range h.buckets {
+		cumulative += h.counts[i]
+		ew.printf("%s_bucket{le=%q} %d\n", name, formatFloat(bound), cumulative)
+	}
+	ew.printf("%s_bucket{le=\"+Inf\"} %d\n", name, h.count)
+	ew.printf("%s_sum %s\n", name, formatFloat(h.sum))
+	ew.printf("%s_count %d\n", name, h.count)
+}
+
+func formatFloat(v float64) string {
+	if math.IsInf(v, 1) {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// errWriter keeps the first write error so exposition code stays linear.
+type errWriter struct {
+	w   io.Writer
+	n   int64
+	err error
+}
+
+func (ew *errWriter) printf(format string, args ...interface{}) {
+	if ew.err != nil {
+		return
+	}
+	n, err := fmt.Fprintf(ew.w, format, args...)
+	ew.n += int64(n)
+	ew.err = err
+}
+
+func (ew *errWriter) header(name, kind, help string) {
+	ew.printf("# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+}
+
+func (ew *errWriter) metric(name, kind, help string, value interface{}) {
+	ew.header(name, kind, help)
+	ew.printf("%s %d\n", name, value)
+}
@@ -0,0 +1,138 @@
+package metrics
+
+import (
+	"bytes"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWriteToExposition(t *testing.T) {
+	pc := NewPrometheusCollector()
+	pc.IncrementConnection()
+	pc.IncrementConnection()
+	pc.DecrementConnection()
+	pc.RecordMessageReceived()
+	pc.RecordSlowConsumer("drop-oldest")
+	pc.RecordSlowConsumer("drop-oldest")
+	pc.RecordSlowConsumer("block")
+	pc.SetRoomCount(3)
+	pc.RecordLatency(20 * time.Millisecond)
+
+	var buf bytes.Buffer
+	n, err := pc.WriteTo(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != int64(buf.Len()) {
+		t.Errorf("WriteTo reported %d bytes, wrote %d", n, buf.Len())
+	}
+	out := buf.String()
+
+	for _, want := range []string{
+		"# HELP hush_connections Currently open WebSocket connections.\n# TYPE hush_connections gauge\nhush_connections 1\n",
+		"# TYPE hush_connections_total counter\nhush_connections_total 2\n",
+		"hush_messages_received_total 1\n",
+		"hush_messages_sent_total 0\n",
+		"hush_rooms 3\n",
+		// Labels are sorted, so scrapes are stable
+		"# TYPE hush_slow_consumers_total counter\n" +
+			"hush_slow_consumers_total{policy=\"block\"} 1\n" +
+			"hush_slow_consumers_total{policy=\"drop-oldest\"} 2\n",
+		"# TYPE hush_ping_rtt_seconds histogram\n",
+		"hush_ping_rtt_seconds_bucket{le=\"0.01\"} 0\n",
+		"hush_ping_rtt_seconds_bucket{le=\"0.025\"} 1\n",
+		"hush_ping_rtt_seconds_bucket{le=\"+Inf\"} 1\n",
+		"hush_ping_rtt_seconds_sum 0.02\n",
+		"hush_ping_rtt_seconds_count 1\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("missing %q in:\n%s", want, out)
+		}
+	}
+
+	// Every sample line belongs to a family declared just before it
+	var family string
+	for _, line := range strings.Split(strings.TrimSuffix(out, "\n"), "\n") {
+		if name, ok := strings.CutPrefix(line, "# TYPE "); ok {
+			family, _, _ = strings.Cut(name, " ")
+			continue
+		}
+		if strings.HasPrefix(line, "#") {
+			continue
+		}
+		if family == "" || !strings.HasPrefix(line, family) {
+			t.Errorf("sample %q outside its family %q", line, family)
+		}
+	}
+}
+
+func TestServeHTTP(t *testing.T) {
+	pc := NewPrometheusCollector()
+	rec := httptest.NewRecorder()
+	pc.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+
+	if ct := rec.Header().Get("Content-Type"); ct != "text/plain; version=0.0.4; charset=utf-8" {
+		t.Errorf("content type %q", ct)
+	}
+	if !strings.Contains(rec.Body.String(), "hush_connections 0\n") {
+		t.Errorf("body:\n%s", rec.Body)
+	}
+}
+
+func TestHistogramBuckets(t *testing.T) {
+	tests := []struct {
+		name         string
+		observations []float64
+		want         string
+	}{
+		{
+			name: "empty",
+			want: `h_bucket{le="1"} 0
+h_bucket{le="2"} 0
+h_bucket{le="5"} 0
+h_bucket{le="+Inf"} 0
+h_sum 0
+h_count 0
+`,
+		},
+		{
+			// Bounds are inclusive, and values above the last one only
+			// count towards +Inf
+			name:         "cumulative",
+			observations: []float64{0.5, 1, 1.5, 2, 10},
+			want: `h_bucket{le="1"} 2
+h_bucket{le="2"} 4
+h_bucket{le="5"} 4
+h_bucket{le="+Inf"} 5
+h_sum 15
+h_count 5
+`,
+		},
+		{
+			name:         "above every bound",
+			observations: []float64{6, 7},
+			want: `h_bucket{le="1"} 0
+h_bucket{le="2"} 0
+h_bucket{le="5"} 0
+h_bucket{le="+Inf"} 2
+h_sum 13
+h_count 2
+`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := newHistogram([]float64{1, 2, 5})
+			for _, v := range tt.observations {
+				h.observe(v)
+			}
+			var buf bytes.Buffer
+			h.writeTo(&errWriter{w: &buf}, "h")
+			if buf.String() != tt.want {
+				t.Errorf("got:\n%swant:\n%s", buf.String(), tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,290 @@
+package websocket
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/fromscript/hush/internal/database"
+	"github.com/fromscript/hush/internal/websocket/models"
+)
+
+// Room settings live in the store, so they hold on every replica and outlast
+// the in-memory room. The first client to join a room owns it, by identity
+// fingerprint if it has registered one, so ownership outlasts the session.
+
+const (
+	defaultInviteTTL = 24 * time.Hour
+	maxInviteTTL     = 7 * 24 * time.Hour
+)
+
+func (dm *DefaultManager) handleJoin(client *models.Client, payload json.RawMessage) {
+	var join models.JoinMessage
+	if err := json.Unmarshal(payload, &join); err != nil || join.RoomID == "" {
+		return
+	}
+	if strings.ContainsFunc(join.RoomID, unicode.IsControl) {
+		dm.sendSystemMessage(client, "error", "invalid room ID")
+		return
+	}
+	if client.AllowedRoom != "" && join.RoomID != client.AllowedRoom {
+		dm.denyJoin(client, join.RoomID, models.DeniedToken)
+		return
+	}
+	// Checked up front, but only taken once the join succeeds
+	handle, err := joinHandle(client, join.Handle)
+	if errors.Is(err, errInvalidHandle) {
+		dm.sendSystemMessage(client, "error", err.Error())
+		return
+	}
+	if err != nil {
+		slog.Error("Failed to generate handle", "session", client.SessionID, "error", err)
+		dm.denyJoin(client, join.RoomID, models.DeniedUnavailable)
+		return
+	}
+
+	settings, reason := dm.admit(client, join)
+	if reason != "" {
+		dm.denyJoin(client, join.RoomID, reason)
+		return
+	}
+	if err := dm.joinRoom(client, join.RoomID, handle, settings.MaxMembers); err != nil {
+		dm.denyJoin(client, join.RoomID, models.DeniedFull)
+		return
+	}
+	dm.sendSystemMessage(client, "joined", join.RoomID)
+	reply := roomSettingsMessage(settings)
+	reply.IsOwner = ownsRoom(client, settings)
+	dm.sendEvent(client, "room_settings", reply)
+	dm.sendHistory(client, database.HistoryQuery{Since: join.Since, Limit: join.Limit})
+}
+
+// admit checks a join against the room's settings, claiming the room for the
+// client if it has none yet. It returns the settings and, if the join is
+// refused, the reason. Owners and current members are always admitted.
+func (dm *DefaultManager) admit(client *models.Client, join models.JoinMessage) (database.RoomSettings, string) {
+	ctx, cancel := context.WithTimeout(context.Background(), storeTimeout)
+	defer cancel()
+
+	settings, err := dm.store.ClaimRoom(ctx, join.RoomID, owner(client))
+	if err != nil {
+		slog.Error("Failed to load room settings", "room", join.RoomID, "error", err)
+		return settings, models.DeniedUnavailable
+	}
+	if ownsRoom(client, settings) {
+		return settings, ""
+	}
+	banned, err := dm.banned(ctx, join.RoomID, client)
+	if err != nil {
+		slog.Error("Failed to check bans", "room", join.RoomID, "error", err)
+		return settings, models.DeniedUnavailable
+	}
+	if banned {
+		return settings, models.DeniedBanned
+	}
+	if room, ok := dm.currentRoom(client); ok && room.ID == join.RoomID {
+		return settings, ""
+	}
+	if settings.Locked {
+		return settings, models.DeniedLocked
+	}
+
+	switch settings.Policy {
+	case database.PolicyPassword:
+		if join.PasswordHash == "" || !hmac.Equal(passwordDigest(join.RoomID, join.PasswordHash), settings.PasswordHash) {
+			return settings, models.DeniedPassword
+		}
+	case database.PolicyInvite:
+		if join.Invite == "" {
+			return settings, models.DeniedInvite
+		}
+		valid, err := dm.store.UseInvite(ctx, join.RoomID, inviteDigest(join.Invite))
+		if err != nil {
+			slog.Error("Failed to check invite", "room", join.RoomID, "error", err)
+			return settings, models.DeniedUnavailable
+		}
+		if !valid {
+			return settings, models.DeniedInvite
+		}
+	}
+	return settings, ""
+}
+
+// readmit checks a resuming session against bans and locks that may have
+// come into force while it was suspended. Its join policy was satisfied when
+// it first joined.
+func (dm *DefaultManager) readmit(client *models.Client, roomID string) (database.RoomSettings, string) {
+	ctx, cancel := context.WithTimeout(context.Background(), storeTimeout)
+	defer cancel()
+
+	settings, err := dm.store.RoomSettings(ctx, roomID)
+	if err != nil && !errors.Is(err, database.ErrNotFound) {
+		slog.Error("Failed to load room settings", "room", roomID, "error", err)
+		return settings, models.DeniedUnavailable
+	}
+	if ownsRoom(client, settings) {
+		return settings, ""
+	}
+	banned, err := dm.banned(ctx, roomID, client)
+	if err != nil {
+		slog.Error("Failed to check bans", "room", roomID, "error", err)
+		return settings, models.DeniedUnavailable
+	}
+	if banned {
+		return settings, models.DeniedBanned
+	}
+	if settings.Locked {
+		return settings, models.DeniedLocked
+	}
+	return settings, ""
+}
+
+func (dm *DefaultManager) denyJoin(client *models.Client, roomID, reason string) {
+	slog.Info("Join denied", "session", client.SessionID, "room", roomID, "reason", reason)
+	dm.sendEvent(client, "join_denied", models.JoinDenied{RoomID: roomID, Reason: reason})
+}
+
+// ownedRoom returns the settings of the client's current room if the client
+// owns it, and tells the client otherwise. It never claims the room.
+func (dm *DefaultManager) ownedRoom(ctx context.Context, client *models.Client) (database.RoomSettings, bool) {
+	room, ok := dm.currentRoom(client)
+	if !ok {
+		dm.sendSystemMessage(client, "error", "join a room first")
+		return database.RoomSettings{}, false
+	}
+	settings, err := dm.store.RoomSettings(ctx, room.ID)
+	if err != nil && !errors.Is(err, database.ErrNotFound) {
+		slog.Error("Failed to load room settings", "room", room.ID, "error", err)
+		dm.sendSystemMessage(client, "error", "room settings unavailable")
+		return settings, false
+	}
+	if !ownsRoom(client, settings) {
+		dm.sendSystemMessage(client, "error", "only the room owner can do that")
+		return settings, false
+	}
+	return settings, true
+}
+
+// handleConfigureRoom lets the owner change the join policy and member limit.
+func (dm *DefaultManager) handleConfigureRoom(client *models.Client, payload json.RawMessage) {
+	var req models.RoomSettingsMessage
+	if err := json.Unmarshal(payload, &req); err != nil {
+		dm.sendSystemMessage(client, "error", "invalid room settings")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), storeTimeout)
+	defer cancel()
+	settings, ok := dm.ownedRoom(ctx, client)
+	if !ok {
+		return
+	}
+
+	switch req.Policy {
+	case database.PolicyOpen, database.PolicyInvite:
+		settings.PasswordHash = nil
+	case database.PolicyPassword:
+		if req.PasswordHash == "" {
+			dm.sendSystemMessage(client, "error", "password rooms need a password hash")
+			return
+		}
+		settings.PasswordHash = passwordDigest(settings.RoomID, req.PasswordHash)
+	default:
+		dm.sendSystemMessage(client, "error", "unknown join policy")
+		return
+	}
+	settings.Policy = req.Policy
+	settings.MaxMembers = max(req.MaxMembers, 0)
+
+	if err := dm.store.SaveRoomSettings(ctx, settings); err != nil {
+		slog.Error("Failed to save room settings", "room", settings.RoomID, "error", err)
+		dm.sendSystemMessage(client, "error", "room settings could not be saved")
+		return
+	}
+	slog.Info("Room settings changed", "room", settings.RoomID, "policy", settings.Policy, "maxMembers", settings.MaxMembers)
+	dm.broadcastEvent(settings.RoomID, "room_settings", roomSettingsMessage(settings))
+}
+
+// handleCreateInvite hands the owner a single-use invite code. Only its
+// digest is stored.
+func (dm *DefaultManager) handleCreateInvite(client *models.Client, payload json.RawMessage) {
+	var req models.InviteMessage
+	if len(payload) > 0 {
+		if err := json.Unmarshal(payload, &req); err != nil {
+			dm.sendSystemMessage(client, "error", "invalid invite request")
+			return
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), storeTimeout)
+	defer cancel()
+	settings, ok := dm.ownedRoom(ctx, client)
+	if !ok {
+		return
+	}
+
+	ttl := defaultInviteTTL
+	if req.TTL > 0 {
+		ttl = min(time.Duration(req.TTL)*time.Second, maxInviteTTL)
+	}
+	code, err := generateInviteCode()
+	if err != nil {
+		slog.Error("Failed to generate invite", "room", settings.RoomID, "error", err)
+		dm.sendSystemMessage(client, "error", "invite could not be created")
+		return
+	}
+	expiresAt := time.Now().Add(ttl)
+	if err := dm.store.AddInvite(ctx, settings.RoomID, inviteDigest(code), expiresAt); err != nil {
+		slog.Error("Failed to store invite", "room", settings.RoomID, "error", err)
+		dm.sendSystemMessage(client, "error", "invite could not be created")
+		return
+	}
+	dm.sendEvent(client, "invite", models.InviteMessage{
+		RoomID:    settings.RoomID,
+		Code:      code,
+		ExpiresAt: expiresAt.UnixMilli(),
+	})
+}
+
+// ownsRoom matches the room's owner against both the client's session and its
+// identity, as the owner may have claimed the room before registering a key.
+func ownsRoom(client *models.Client, settings database.RoomSettings) bool {
+	return isAuthor(client, settings.Owner)
+}
+
+func roomSettingsMessage(settings database.RoomSettings) models.RoomSettingsMessage {
+	return models.RoomSettingsMessage{
+		RoomID:     settings.RoomID,
+		Policy:     settings.Policy,
+		MaxMembers: settings.MaxMembers,
+		Locked:     settings.Locked,
+	}
+}
+
+// passwordDigest binds the client-side password hash to its room, so the
+// stored value is useless for joining any room directly.
+func passwordDigest(roomID, passwordHash string) []byte {
+	sum := sha256.Sum256([]byte(roomID + "\x00" + passwordHash))
+	return sum[:]
+}
+
+func inviteDigest(code string) []byte {
+	sum := sha256.Sum256([]byte(code))
+	return sum[:]
+}
+
+func generateInviteCode() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
@@ -0,0 +1,109 @@
+package websocket
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+
+	"github.com/fromscript/hush/internal/websocket/models"
+)
+
+// clusterEnvelope is what replicas publish to a room's bus channel. Frames too
+// large for the bus are not inlined; if they are stored messages, receivers
+// load them from the store by Ref instead. Type is set when the frame is an
+// event about the stored message, such as an edit, rather than the message.
+type clusterEnvelope struct {
+	Origin  string          `json:"origin"`
+	Message *models.Message `json:"message,omitempty"`
+	Ref     string          `json:"ref,omitempty"`
+	Type    string          `json:"type,omitempty"`
+}
+
+func (dm *DefaultManager) publishToCluster(roomID string, msg models.Message) {
+	payload, err := json.Marshal(clusterEnvelope{Origin: dm.nodeID, Message: &msg})
+	if err != nil {
+		slog.Error("Failed to encode cluster envelope", "room", roomID, "error", err)
+		return
+	}
+
+	if len(payload) > dm.bus.MaxPayload() {
+		if msg.ID == "" {
+			slog.Warn("Frame too large for cluster relay, delivered locally only", "room", roomID, "type", msg.Type, "size", len(payload))
+			return
+		}
+		envelope := clusterEnvelope{Origin: dm.nodeID, Ref: msg.ID}
+		if msg.Type != "message" {
+			envelope.Type = msg.Type
+		}
+		payload, _ = json.Marshal(envelope)
+	}
+
+	ctx, cancel := context.WithTimeout(dm.shutdownCtx, storeTimeout)
+	defer cancel()
+	if err := dm.bus.Publish(ctx, roomID, payload); err != nil {
+		slog.Error("Failed to publish to cluster", "room", roomID, "error", err)
+	}
+}
+
+// runRelay delivers frames published by other replicas to local members.
+func (dm *DefaultManager) runRelay(ctx context.Context) {
+	for {
+		select {
+		case n := <-dm.bus.Notifications():
+			var envelope clusterEnvelope
+			if err := json.Unmarshal(n.Payload, &envelope); err != nil {
+				slog.Warn("Invalid cluster envelope", "room", n.RoomID, "error", err)
+				continue
+			}
+			if envelope.Origin == dm.nodeID {
+				continue
+			}
+			if n.RoomID == directChannel {
+				dm.relayDirect(ctx, envelope)
+				continue
+			}
+
+			msg, ok := dm.resolveEnvelope(ctx, n.RoomID, envelope)
+			if !ok {
+				continue
+			}
+			if room, ok := dm.rooms.Load(n.RoomID); ok {
+				room.(*models.Room).Touch()
+			}
+			dm.observeRekey(n.RoomID, msg)
+			dm.observePresence(n.RoomID, msg)
+			dm.deliverToRoom(n.RoomID, msg)
+			dm.observeModeration(n.RoomID, msg)
+
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (dm *DefaultManager) resolveEnvelope(ctx context.Context, roomID string, envelope clusterEnvelope) (models.Message, bool) {
+	if envelope.Message != nil {
+		return *envelope.Message, true
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, storeTimeout)
+	defer cancel()
+	record, err := dm.store.Message(ctx, roomID, envelope.Ref)
+	if err != nil {
+		slog.Warn("Failed to load spilled cluster message", "room", roomID, "id", envelope.Ref, "error", err)
+		return models.Message{}, false
+	}
+
+	var msg models.Message
+	if err := json.Unmarshal(record.Content, &msg); err != nil {
+		slog.Warn("Invalid spilled cluster message", "room", roomID, "id", envelope.Ref, "error", err)
+		return models.Message{}, false
+	}
+	msg.ID = record.ID
+	msg.Seq = record.Seq
+	if envelope.Type != "" {
+		msg.Type = envelope.Type
+		msg.Seq = 0
+	}
+	return msg, true
+}
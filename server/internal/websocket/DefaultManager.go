@@ -5,13 +5,20 @@ import (
 	"crypto/rand"
 	"encoding/base64"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"log/slog"
 	"net/http"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/coder/websocket"
 	"github.com/coder/websocket/wsjson"
+	"github.com/fromscript/hush/internal/auth"
+	"github.com/fromscript/hush/internal/cluster"
+	"github.com/fromscript/hush/internal/database"
+	"github.com/fromscript/hush/internal/metrics"
 	"github.com/fromscript/hush/internal/websocket/models"
 )
 
@@ -19,24 +26,97 @@ const (
 	writeTimeout   = 10 * time.Second
 	pingInterval   = 30 * time.Second
 	maxMessageSize = 1024 * 1024 // 1MB
+	storeTimeout   = 5 * time.Second
 	NormalClosure  = websocket.StatusNormalClosure
 	InternalError  = websocket.StatusInternalError
+
+	defaultHistoryLimit = 50
+	maxHistoryLimit     = 200
+
+	maxMessageTTL  = 7 * 24 * time.Hour
+	reaperInterval = 10 * time.Second
+
+	defaultRoomExpiry = 24 * time.Hour
+	janitorInterval   = time.Minute
+
+	defaultResumeWindow = 2 * time.Minute
+	resumeBufferSize    = 128
+
+	ackTimeout           = 10 * time.Second
+	ackCheckInterval     = 2 * time.Second
+	maxDeliveryAttempts  = 3
+	maxPendingDeliveries = 512
 )
 
 type DefaultManager struct {
-	clients   sync.Map // map[string]*models.Client
-	rooms     sync.Map // map[string]*models.Room
-	authToken string
+	clients      sync.Map // map[string]*models.Client
+	rooms        sync.Map // map[string]*models.Room
+	suspended    sync.Map // map[string]*models.SuspendedSession (sessionID -> session)
+	resumeTokens sync.Map // map[string]string (resume token -> sessionID)
+	receiptsDue  sync.Map // map[string]struct{} (room IDs with new read markers)
+	tokens       *auth.Signer
+	store        database.MessageStore
+	files        database.FileStore // nil disables file transfer
+	fileQuota    int64
+	bus          cluster.Bus
+	nodeID       string
+	roomExpiry   time.Duration
+	roomCount    atomic.Int64
+	metrics      metrics.Collector
+
+	resumeWindow time.Duration
+	slowConsumer models.SlowConsumerPolicy
+	roomPolicies map[string]models.SlowConsumerPolicy // read-only after construction
+
+	shutdownCtx context.Context
+	cancelFunc  context.CancelFunc
 }
 
-func NewDefaultManager(authToken string) *DefaultManager {
-	return &DefaultManager{
-		authToken: authToken,
+func NewDefaultManager(tokens *auth.Signer, opts ...Option) *DefaultManager {
+	dm := &DefaultManager{
+		tokens:     tokens,
+		roomExpiry: defaultRoomExpiry,
+
+		resumeWindow: defaultResumeWindow,
+	}
+	for _, opt := range opts {
+		opt(dm)
+	}
+	if dm.store == nil {
+		dm.store = database.NewMemoryStore(0)
 	}
+	if dm.bus == nil {
+		dm.bus = cluster.NewLocalBus()
+	}
+	if dm.fileQuota <= 0 {
+		dm.fileQuota = defaultRoomFileQuota
+	}
+	if dm.metrics == nil {
+		dm.metrics = &metrics.DefaultCollector{}
+	}
+	dm.nodeID, _ = generateSessionID()
+
+	dm.shutdownCtx, dm.cancelFunc = context.WithCancel(context.Background())
+	go dm.runReaper(dm.shutdownCtx)
+	go dm.runJanitor(dm.shutdownCtx)
+	go dm.runRelay(dm.shutdownCtx)
+	go dm.runReceipts(dm.shutdownCtx)
+	if err := dm.bus.Subscribe(directChannel); err != nil {
+		slog.Error("Failed to subscribe to direct messages", "error", err)
+	}
+	return dm
+}
+
+// Shutdown stops the manager's background workers.
+func (dm *DefaultManager) Shutdown() {
+	dm.cancelFunc()
 }
 
 func (dm *DefaultManager) UpgradeHandler(w http.ResponseWriter, r *http.Request) {
-	if r.URL.Query().Get("token") != dm.authToken {
+	claims, err := dm.tokens.Verify(r.URL.Query().Get("token"))
+	if err != nil {
+		slog.Info("Rejected connection token", "remote", r.RemoteAddr, "error", err)
+		dm.metrics.RecordAuthFailure()
 		http.Error(w, "Unauthorized", http.StatusUnauthorized)
 		return
 	}
@@ -46,17 +126,31 @@ func (dm *DefaultManager) UpgradeHandler(w http.ResponseWriter, r *http.Request)
 	})
 	if err != nil {
 		slog.Error("WebSocket upgrade failed", "error", err)
+		dm.metrics.RecordUpgradeFailure()
 		return
 	}
+	dm.metrics.IncrementConnection()
+
+	// Redeemed only once upgraded, so a failed upgrade can still resume
+	var resumed *models.SuspendedSession
+	if token := r.URL.Query().Get("resume"); token != "" {
+		resumed = dm.takeSuspendedSession(token)
+	}
 
 	sessionID, _ := generateSessionID()
+	if resumed != nil {
+		sessionID = resumed.SessionID
+	}
 	client := &models.Client{
-		Conn:      conn,
-		SessionID: sessionID,
-		Send:      make(chan models.Message, 256),
+		Conn:        conn,
+		SessionID:   sessionID,
+		Send:        make(chan models.Message, 256),
+		AllowedRoom: claims.Room,
+		Deliveries:  models.NewDeliveryTracker(maxPendingDeliveries),
 	}
 
 	dm.clients.Store(sessionID, client)
+	dm.startSession(client, resumed)
 	go dm.handleConnection(client)
 }
 
@@ -66,7 +160,10 @@ func (dm *DefaultManager) handleConnection(client *models.Client) {
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
-	go dm.readPump(ctx, client)
+	go func() {
+		dm.readPump(ctx, client)
+		cancel()
+	}()
 	dm.writePump(ctx, client)
 	slog.Info("Connection created")
 }
@@ -91,6 +188,7 @@ func (dm *DefaultManager) readPump(ctx context.Context, client *models.Client) {
 			slog.Warn("Invalid message format", "session", client.SessionID, "error", err)
 			continue
 		}
+		dm.metrics.RecordMessageReceived()
 
 		dm.processMessage(client, msg)
 	}
@@ -99,38 +197,232 @@ func (dm *DefaultManager) readPump(ctx context.Context, client *models.Client) {
 func (dm *DefaultManager) processMessage(client *models.Client, msg models.Message) {
 	switch msg.Type {
 	case "join":
-		var joinMsg models.JoinMessage
-		if err := json.Unmarshal(msg.Payload, &joinMsg); err == nil {
-			dm.joinRoom(client, joinMsg.RoomID)
-			dm.sendSystemMessage(client, "joined", joinMsg.RoomID)
+		dm.handleJoin(client, msg.Payload)
+	case "configure_room":
+		dm.handleConfigureRoom(client, msg.Payload)
+	case "roster":
+		dm.handleRoster(client)
+	case "typing":
+		dm.handleTyping(client)
+	case "create_invite":
+		dm.handleCreateInvite(client, msg.Payload)
+	case "kick", "ban", "mute", "lock", "unlock":
+		dm.handleModeration(client, msg.Type, msg.Payload)
+	case "history":
+		var req models.HistoryRequest
+		if err := json.Unmarshal(msg.Payload, &req); err == nil && dm.inRoom(client) {
+			dm.sendHistory(client, database.HistoryQuery{Since: req.Since, Before: req.Before, Limit: req.Limit})
 		}
+	case "thread_history":
+		dm.handleThreadHistory(client, msg.Payload)
+	case "subscribe_thread", "unsubscribe_thread":
+		dm.handleThreadSubscription(client, msg.Type == "subscribe_thread", msg.Payload)
 	case "message":
-		if client.RoomID != "" {
-			dm.broadcastToRoom(client.RoomID, msg)
+		room, ok := dm.currentRoom(client)
+		if !ok {
+			dm.sendSystemMessage(client, "error", "join a room first")
+			return
+		}
+		if room.Muted(client) {
+			dm.sendSystemMessage(client, "error", "you are muted in this room")
+			return
+		}
+		// Clients cannot set what the server stamps
+		msg.Recipient = ""
+		msg.Reactions = nil
+		msg.EditedAt = 0
+		msg.To = ""
+		msg.Handle = client.Handle()
+		msg.Origin = client.SessionID
+		if !dm.resolveThread(client, room.ID, &msg) {
+			return
+		}
+		if !dm.authenticate(client, room, &msg) {
+			return
+		}
+		if staleEpoch(room, msg) {
+			dm.sendEvent(client, "stale_epoch", models.RekeyMessage{RoomID: room.ID, Epoch: room.Epoch()})
+			return
+		}
+		room.Sequencer.Lock()
+		defer room.Sequencer.Unlock()
+		if err := dm.persistMessage(room.ID, &msg); err != nil {
+			slog.Error("Failed to persist message", "session", client.SessionID, "room", room.ID, "error", err)
+			dm.sendSystemMessage(client, "error", "message could not be stored")
+			return
+		}
+		room.Touch()
+		dm.broadcastToRoom(room.ID, msg)
+	case "edit":
+		dm.handleEdit(client, msg)
+	case "delete":
+		dm.handleDelete(client, msg)
+	case "react":
+		dm.handleReact(client, msg)
+	case "direct":
+		dm.handleDirect(client, msg)
+	case "direct_ack":
+		dm.handleDirectAck(client, msg.Payload)
+	case "identity":
+		dm.handleIdentity(client, msg.Payload)
+	case "key_bundle":
+		dm.handleKeyBundle(client, msg.Payload)
+	case "key_request":
+		dm.handleKeyRequest(client)
+	case "key_share":
+		dm.handleKeyShare(client, msg.Payload)
+	case "read":
+		dm.handleRead(client, msg.Payload)
+	case "file_begin":
+		dm.handleFileBegin(client, msg.Payload)
+	case "file_chunk":
+		dm.handleFileChunk(client, msg.Payload)
+	case "file_end":
+		dm.handleFileEnd(client, msg.Payload)
+	case "file_get":
+		dm.handleFileGet(client, msg.Payload)
+	case "ack":
+		var ack models.AckMessage
+		if err := json.Unmarshal(msg.Payload, &ack); err == nil {
+			client.Deliveries.Ack(ack.Seq)
 		}
 	default:
 		slog.Warn("Unknown message type", "type", msg.Type)
 	}
 }
 
+func (dm *DefaultManager) persistMessage(roomID string, msg *models.Message) error {
+	id, err := generateMessageID()
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	msg.ID = id
+	msg.Timestamp = now.UnixMilli()
+	msg.ExpiresAt = 0
+	if msg.TTL > 0 {
+		ttl := min(time.Duration(msg.TTL)*time.Second, maxMessageTTL)
+		msg.ExpiresAt = now.Add(ttl).UnixMilli()
+	}
+
+	content, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), storeTimeout)
+	defer cancel()
+
+	record := &database.Message{
+		ID:        msg.ID,
+		RoomID:    roomID,
+		Author:    msg.Sender,
+		ThreadID:  msg.ThreadID,
+		Content:   content,
+		CreatedAt: now.UTC(),
+	}
+	if record.Author == "" {
+		record.Author = msg.Origin
+	}
+	if msg.ExpiresAt != 0 {
+		record.ExpiresAt = time.UnixMilli(msg.ExpiresAt).UTC()
+	}
+	if err := dm.store.SaveMessage(ctx, record); err != nil {
+		return err
+	}
+	msg.Seq = record.Seq
+	return nil
+}
+
+// sendHistory replies with one page of the client's current room, or of one
+// of its threads. A page is fetched with one extra row so the reply can tell
+// whether more remain.
+func (dm *DefaultManager) sendHistory(client *models.Client, q database.HistoryQuery) {
+	if q.Limit <= 0 {
+		q.Limit = defaultHistoryLimit
+	}
+	q.Limit = min(q.Limit, maxHistoryLimit)
+	limit := q.Limit
+	q.Limit++
+
+	ctx, cancel := context.WithTimeout(context.Background(), storeTimeout)
+	defer cancel()
+
+	roomID := client.RoomID()
+	records, err := dm.store.History(ctx, roomID, q)
+	if err != nil {
+		slog.Error("Failed to load history", "session", client.SessionID, "room", roomID, "error", err)
+		dm.sendSystemMessage(client, "error", "history unavailable")
+		return
+	}
+
+	hasMore := len(records) > limit
+	if hasMore {
+		// Forward pages drop the newest extra row, backward pages the oldest
+		if q.Since > 0 {
+			records = records[:limit]
+		} else {
+			records = records[1:]
+		}
+	}
+
+	history := models.HistoryMessage{
+		RoomID:   roomID,
+		ThreadID: q.ThreadID,
+		Messages: make([]models.Message, 0, len(records)),
+		HasMore:  hasMore,
+	}
+	for _, record := range records {
+		var msg models.Message
+		if err := json.Unmarshal(record.Content, &msg); err != nil {
+			slog.Warn("Skipping undecodable stored message", "room", roomID, "id", record.ID, "error", err)
+			continue
+		}
+		msg.ID = record.ID
+		msg.Seq = record.Seq
+		history.Messages = append(history.Messages, msg)
+	}
+
+	if q.ThreadID != "" {
+		dm.sendEvent(client, "thread_history", history)
+		return
+	}
+	dm.sendEvent(client, "history", history)
+}
+
 func (dm *DefaultManager) writePump(ctx context.Context, client *models.Client) {
 	ticker := time.NewTicker(pingInterval)
 	defer ticker.Stop()
+	ackTicker := time.NewTicker(ackCheckInterval)
+	defer ackTicker.Stop()
 
 	for {
 		select {
 		case msg := <-client.Send:
-			err := wsjson.Write(ctx, client.Conn, msg)
+			if msg.Expired(time.Now()) {
+				continue
+			}
+			err := dm.write(ctx, client, msg)
 			if err != nil {
 				slog.Warn("Write error", "session", client.SessionID, "error", err)
 				return
 			}
 
+		case <-ackTicker.C:
+			if err := dm.redeliver(ctx, client); err != nil {
+				slog.Warn("Write error", "session", client.SessionID, "error", err)
+				return
+			}
+
 		case <-ticker.C:
+			dm.metrics.RecordPing(client.SessionID)
+			start := time.Now()
 			if err := client.Conn.Ping(ctx); err != nil {
 				slog.Warn("Ping failed", "session", client.SessionID, "error", err)
 				return
 			}
+			dm.metrics.RecordPong(client.SessionID)
+			dm.metrics.RecordLatency(time.Since(start))
 
 		case <-ctx.Done():
 			return
@@ -138,38 +430,159 @@ func (dm *DefaultManager) writePump(ctx context.Context, client *models.Client)
 	}
 }
 
+// redeliver resends unacknowledged room messages and reports those that ran
+// out of attempts. It writes to the connection directly, so it works even
+// when Send is full.
+func (dm *DefaultManager) redeliver(ctx context.Context, client *models.Client) error {
+	due, gaps := client.Deliveries.Due(time.Now(), ackTimeout, maxDeliveryAttempts)
+	for _, gap := range gaps {
+		slog.Warn("Messages not delivered", "session", client.SessionID, "room", gap.RoomID, "from", gap.From, "to", gap.To)
+		if err := dm.write(ctx, client, newEvent("gap", gap)); err != nil {
+			return err
+		}
+	}
+	for _, msg := range due {
+		if msg.Expired(time.Now()) {
+			continue
+		}
+		if err := dm.write(ctx, client, msg); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (dm *DefaultManager) write(ctx context.Context, client *models.Client, msg models.Message) error {
+	ctx, cancel := context.WithTimeout(ctx, writeTimeout)
+	defer cancel()
+
+	if err := wsjson.Write(ctx, client.Conn, msg); err != nil {
+		return err
+	}
+	dm.metrics.RecordMessageSent()
+	return nil
+}
+
 func (dm *DefaultManager) getOrCreateRoom(roomID string) *models.Room {
-	actual, _ := dm.rooms.LoadOrStore(roomID, &models.Room{
-		ID:      roomID,
-		Members: sync.Map{},
-	})
+	if room, ok := dm.rooms.Load(roomID); ok {
+		return room.(*models.Room)
+	}
+	actual, loaded := dm.rooms.LoadOrStore(roomID, models.NewRoom(roomID))
+	if !loaded {
+		dm.metrics.SetRoomCount(int(dm.roomCount.Add(1)))
+		if err := dm.bus.Subscribe(roomID); err != nil {
+			slog.Error("Failed to subscribe to room", "room", roomID, "error", err)
+		}
+	}
 	return actual.(*models.Room)
 }
 
-func (dm *DefaultManager) joinRoom(client *models.Client, roomID string) {
-	// Leave previous room
-	if client.RoomID != "" {
-		if room, ok := dm.rooms.Load(client.RoomID); ok {
-			room.(*models.Room).Members.Delete(client.SessionID)
-		}
+// currentRoom returns the room the client is a member of. Membership can end
+// without the client asking, e.g. when the janitor expires the room.
+func (dm *DefaultManager) currentRoom(client *models.Client) (*models.Room, bool) {
+	roomID := client.RoomID()
+	if roomID == "" {
+		return nil, false
+	}
+	room, ok := dm.rooms.Load(roomID)
+	if !ok || !room.(*models.Room).Has(client.SessionID) {
+		return nil, false
 	}
+	return room.(*models.Room), true
+}
+
+func (dm *DefaultManager) inRoom(client *models.Client) bool {
+	_, ok := dm.currentRoom(client)
+	return ok
+}
 
+// joinRoom moves the client into roomID under handle, or its current handle
+// if that is empty. A client that does not fit stays in its previous room
+// with its old handle.
+func (dm *DefaultManager) joinRoom(client *models.Client, roomID, handle string, maxMembers int) error {
+	previous, wasMember := dm.currentRoom(client)
+	// A member keeps its old handle until it has left its previous room
+	previousHandle := client.Handle()
+	if !wasMember && handle != "" {
+		client.SetHandle(handle)
+	}
+
+	// A room closed by the janitor in the meantime is replaced by a fresh one
 	room := dm.getOrCreateRoom(roomID)
-	room.Members.Store(client.SessionID, client)
-	client.RoomID = roomID
+	for {
+		err := room.Add(client, maxMembers)
+		if err == nil {
+			break
+		}
+		if !errors.Is(err, models.ErrRoomClosed) {
+			client.SetHandle(previousHandle)
+			return err
+		}
+		room = dm.getOrCreateRoom(roomID)
+	}
+
+	// Leave previous room
+	rejoined := wasMember && previous == room
+	if wasMember && !rejoined {
+		dm.leaveRoom(previous, client)
+	}
+	if wasMember && handle != "" {
+		client.SetHandle(handle)
+	}
+	client.Deliveries.Reset(roomID)
+	if !rejoined {
+		client.ResetThreads()
+	}
+	client.SetRoomID(roomID)
+	if !rejoined {
+		dm.announcePresence(roomID, client, "joined")
+	}
+	dm.sendKeyBundles(client, room)
+	dm.requireRekey(room, "join")
+
+	ctx, cancel := context.WithTimeout(context.Background(), storeTimeout)
+	defer cancel()
+	if err := dm.store.TouchRoom(ctx, roomID); err != nil {
+		slog.Warn("Failed to record room activity", "room", roomID, "error", err)
+	}
 	slog.Info("Client joined room", "session", client.SessionID, "room", roomID)
+	return nil
 }
 
+// broadcastToRoom delivers msg to the room's members on every replica.
 func (dm *DefaultManager) broadcastToRoom(roomID string, msg models.Message) {
+	if msg.Expired(time.Now()) {
+		return
+	}
+	dm.deliverToRoom(roomID, msg)
+	dm.publishToCluster(roomID, msg)
+}
+
+// deliverToRoom delivers msg to the room's members connected to this replica.
+func (dm *DefaultManager) deliverToRoom(roomID string, msg models.Message) {
+	if msg.Expired(time.Now()) {
+		return
+	}
 	if room, ok := dm.rooms.Load(roomID); ok {
+		policy := dm.slowConsumerPolicy(roomID)
 		room.(*models.Room).Members.Range(func(_, value interface{}) bool {
 			client := value.(*models.Client)
-			if client.SessionID != msg.SessionID {
-				select {
-				case client.Send <- msg:
-				default:
-					slog.Warn("Client buffer full", "session", client.SessionID)
-				}
+			if msg.Recipient != "" && client.Fingerprint() != msg.Recipient {
+				return true
+			}
+			if !client.Wants(msg) {
+				return true
+			}
+			if client.SessionID != msg.Origin {
+				// Messages that did not fit are retried by redeliver
+				client.Deliveries.Track(msg, dm.enqueue(client, msg, policy))
+			}
+			return true
+		})
+		room.(*models.Room).Suspended.Range(func(_, value interface{}) bool {
+			suspended := value.(*models.SuspendedSession)
+			if suspended.SessionID != msg.Origin && msg.Recipient == "" {
+				suspended.Buffer(msg)
 			}
 			return true
 		})
@@ -178,22 +591,63 @@ func (dm *DefaultManager) broadcastToRoom(roomID string, msg models.Message) {
 
 func (dm *DefaultManager) sendSystemMessage(client *models.Client, msgType string, data interface{}) {
 	payload, _ := json.Marshal(data)
-	client.Send <- models.Message{
+	dm.enqueue(client, models.Message{
 		Type:    "system",
 		Payload: payload,
+	}, dm.slowConsumer)
+}
+
+// sendEvent delivers a typed server event, as opposed to sendSystemMessage
+// whose payload is shown to the user verbatim.
+func (dm *DefaultManager) sendEvent(client *models.Client, msgType string, data interface{}) {
+	dm.enqueue(client, newEvent(msgType, data), dm.slowConsumer)
+}
+
+// broadcastEvent delivers a typed server event to every member of a room.
+func (dm *DefaultManager) broadcastEvent(roomID string, msgType string, data interface{}) {
+	dm.broadcastToRoom(roomID, newEvent(msgType, data))
+}
+
+// broadcastEventFrom is broadcastEvent without echoing the event to origin.
+func (dm *DefaultManager) broadcastEventFrom(origin *models.Client, roomID string, msgType string, data interface{}) {
+	msg := newEvent(msgType, data)
+	msg.Origin = origin.SessionID
+	dm.broadcastToRoom(roomID, msg)
+}
+
+func newEvent(msgType string, data interface{}) models.Message {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		slog.Error("Failed to encode event", "type", msgType, "error", err)
+	}
+	return models.Message{
+		Type:      msgType,
+		Payload:   payload,
+		Timestamp: time.Now().UnixMilli(),
 	}
 }
 
 func (dm *DefaultManager) cleanupClient(client *models.Client) {
-	dm.clients.Delete(client.SessionID)
-	client.Conn.Close(NormalClosure, "Connection closed")
-	close(client.Send)
+	if !client.MarkClosed() {
+		return
+	}
+	// A resumed session reuses the ID, so only remove this very client
+	dm.clients.CompareAndDelete(client.SessionID, client)
+	dm.metrics.DecrementConnection()
 
-	if client.RoomID != "" {
-		if room, ok := dm.rooms.Load(client.RoomID); ok {
-			room.(*models.Room).Members.Delete(client.SessionID)
-		}
+	// Suspend before leaving the room, so it never looks empty in between,
+	// and leave before closing Send, so broadcasts stop reaching it
+	room, member := dm.currentRoom(client)
+	if !member {
+		client.SetRoomID("")
 	}
+	dm.suspendSession(client)
+	if member {
+		dm.leaveRoom(room, client)
+	}
+
+	// Send is left open: a concurrent broadcast may still hold the client
+	client.Conn.Close(NormalClosure, "Connection closed")
 }
 
 func generateSessionID() (string, error) {
@@ -203,3 +657,15 @@ func generateSessionID() (string, error) {
 	}
 	return base64.URLEncoding.EncodeToString(b), nil
 }
+
+// generateMessageID returns a random (version 4) UUID, matching the type of
+// the messages.id column.
+func generateMessageID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:]), nil
+}
@@ -0,0 +1,283 @@
+package websocket
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/fromscript/hush/internal/crypto"
+	"github.com/fromscript/hush/internal/database"
+	"github.com/fromscript/hush/internal/websocket/models"
+)
+
+// Direct messages go to a single recipient, addressed by identity fingerprint
+// or display handle. Fingerprints reach the identity on whichever replica it
+// is connected to, and messages to a stored identity are also queued until
+// the recipient acknowledges them, so they reach it on its next connect.
+// Anyone may pick a handle, so a handle is resolved to a session when the
+// message is sent and only if exactly one session on this replica holds it;
+// clients should address identities for anything that matters and encrypt
+// the payload for the recipient.
+
+const (
+	// directChannel is the bus channel direct messages are relayed on. Room
+	// IDs cannot contain control characters, so it never names a room.
+	directChannel = "\x00direct"
+
+	maxDirectTTL     = 7 * 24 * time.Hour
+	maxPendingDirect = 200
+)
+
+// directLimits caps the offline queue of each identity, so nobody can fill
+// it for a recipient before the messages expire.
+var directLimits = database.DirectLimits{Queued: 1000, PerSender: 100}
+
+var (
+	errNoRecipient        = errors.New("no such recipient")
+	errAmbiguousRecipient = errors.New("several members use this handle, address their identity instead")
+)
+
+func (dm *DefaultManager) handleDirect(client *models.Client, msg models.Message) {
+	// Handles and fingerprints both fit in maxHandleLength
+	if msg.To == "" || len(msg.To) > maxHandleLength {
+		dm.sendSystemMessage(client, "error", "invalid recipient")
+		return
+	}
+	if !dm.authenticateDirect(client, &msg) {
+		return
+	}
+	recipient, stored, err := dm.directRecipient(msg.To)
+	if err != nil {
+		dm.sendSystemMessage(client, "error", err.Error())
+		return
+	}
+
+	id, err := generateMessageID()
+	if err != nil {
+		slog.Error("Failed to generate message ID", "error", err)
+		return
+	}
+	now := time.Now()
+	msg.ID = id
+	msg.Timestamp = now.UnixMilli()
+	msg.Handle = client.Handle()
+	msg.Origin = client.SessionID
+	msg.Epoch = 0
+	msg.Recipient = ""
+	msg.ExpiresAt = 0
+	if msg.TTL > 0 {
+		msg.ExpiresAt = now.Add(min(time.Duration(msg.TTL)*time.Second, maxDirectTTL)).UnixMilli()
+	}
+
+	if stored {
+		err := dm.queueDirect(client, msg, now)
+		if errors.Is(err, database.ErrQueueFull) {
+			dm.sendSystemMessage(client, "error", "the recipient's queue is full")
+			return
+		}
+		if err != nil {
+			slog.Error("Failed to queue direct message", "session", client.SessionID, "error", err)
+			dm.sendSystemMessage(client, "error", "direct message could not be stored")
+			return
+		}
+	}
+
+	if recipient != nil {
+		dm.enqueue(recipient, msg, dm.slowConsumer)
+	} else {
+		dm.deliverDirect(msg)
+		dm.publishDirect(msg, stored)
+	}
+	dm.sendEvent(client, "direct_sent", models.DirectSent{ID: msg.ID, To: msg.To, Queued: stored})
+}
+
+// directRecipient decides how to reach to. A fingerprint of a stored or
+// connected identity is addressed as is, with a nil session, and reported as
+// stored if messages can be queued for it. Anything else is a handle,
+// resolved to the one session on this replica that holds it.
+func (dm *DefaultManager) directRecipient(to string) (session *models.Client, stored bool, err error) {
+	ctx, cancel := context.WithTimeout(context.Background(), storeTimeout)
+	defer cancel()
+	if stored, err = dm.store.IdentityExists(ctx, to); err != nil || stored {
+		return nil, stored, err
+	}
+
+	var identity bool
+	var holders []*models.Client
+	dm.clients.Range(func(_, value interface{}) bool {
+		client := value.(*models.Client)
+		identity = identity || client.IdentityFingerprint() == to
+		if client.Handle() == to {
+			holders = append(holders, client)
+		}
+		return true
+	})
+	switch {
+	case identity:
+		return nil, false, nil
+	case len(holders) == 1:
+		return holders[0], false, nil
+	case len(holders) > 1:
+		return nil, false, errAmbiguousRecipient
+	default:
+		return nil, false, errNoRecipient
+	}
+}
+
+// authenticateDirect is authenticate for direct messages, which are signed
+// for their recipient instead of a room.
+func (dm *DefaultManager) authenticateDirect(client *models.Client, msg *models.Message) bool {
+	msg.Sender = ""
+	identity := client.Identity()
+	if identity == nil {
+		msg.Signature = nil
+		return true
+	}
+
+	input := crypto.DirectSigningInput(msg.To, msg.TTL, msg.Payload)
+	if err := crypto.Verify(identity.PublicKey, input, msg.Signature); err != nil {
+		slog.Info("Rejected unsigned or forged direct message", "session", client.SessionID)
+		dm.sendSystemMessage(client, "error", "message signature does not verify")
+		return false
+	}
+	msg.Sender = identity.Fingerprint
+	return true
+}
+
+// queueDirect stores msg for the stored identity it is addressed to. Queued
+// messages expire after their TTL, or after maxDirectTTL without one.
+func (dm *DefaultManager) queueDirect(client *models.Client, msg models.Message, now time.Time) error {
+	ctx, cancel := context.WithTimeout(context.Background(), storeTimeout)
+	defer cancel()
+
+	content, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	record := &database.DirectMessage{
+		ID:        msg.ID,
+		Recipient: msg.To,
+		Sender:    owner(client),
+		Content:   content,
+		CreatedAt: now.UTC(),
+		ExpiresAt: now.Add(maxDirectTTL).UTC(),
+	}
+	if msg.ExpiresAt != 0 {
+		record.ExpiresAt = time.UnixMilli(msg.ExpiresAt).UTC()
+	}
+	return dm.store.QueueDirect(ctx, record, directLimits)
+}
+
+// deliverDirect hands msg to the recipient identity's sessions on this
+// replica. Handles never match here, since anyone may take one.
+func (dm *DefaultManager) deliverDirect(msg models.Message) {
+	if msg.Expired(time.Now()) {
+		return
+	}
+	dm.clients.Range(func(_, value interface{}) bool {
+		client := value.(*models.Client)
+		if client.SessionID == msg.Origin {
+			return true
+		}
+		if client.IdentityFingerprint() == msg.To {
+			dm.enqueue(client, msg, dm.slowConsumer)
+		}
+		return true
+	})
+}
+
+// publishDirect relays msg to the other replicas. Queued messages too large
+// for the bus are loaded from the store by the receivers, like room messages.
+func (dm *DefaultManager) publishDirect(msg models.Message, queued bool) {
+	envelope := clusterEnvelope{Origin: dm.nodeID, Message: &msg}
+	payload, err := json.Marshal(envelope)
+	if err != nil {
+		slog.Error("Failed to encode cluster envelope", "type", msg.Type, "error", err)
+		return
+	}
+	if len(payload) > dm.bus.MaxPayload() {
+		if !queued {
+			slog.Warn("Direct message too large for cluster relay, delivered locally only", "size", len(payload))
+			return
+		}
+		payload, _ = json.Marshal(clusterEnvelope{Origin: dm.nodeID, Ref: msg.ID})
+	}
+
+	ctx, cancel := context.WithTimeout(dm.shutdownCtx, storeTimeout)
+	defer cancel()
+	if err := dm.bus.Publish(ctx, directChannel, payload); err != nil {
+		slog.Error("Failed to publish direct message to cluster", "error", err)
+	}
+}
+
+// relayDirect delivers a direct message published by another replica.
+func (dm *DefaultManager) relayDirect(ctx context.Context, envelope clusterEnvelope) {
+	if envelope.Message != nil {
+		dm.deliverDirect(*envelope.Message)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, storeTimeout)
+	defer cancel()
+	record, err := dm.store.DirectMessage(ctx, envelope.Ref)
+	if err != nil {
+		slog.Warn("Failed to load spilled direct message", "id", envelope.Ref, "error", err)
+		return
+	}
+	if msg, ok := decodeDirect(record); ok {
+		dm.deliverDirect(msg)
+	}
+}
+
+// flushDirect saves a newly registered identity, so messages can be queued
+// for it from now on, and sends what is already waiting for it. Messages stay
+// queued until the client acknowledges them with "direct_ack".
+func (dm *DefaultManager) flushDirect(client *models.Client, identity *models.Identity) {
+	ctx, cancel := context.WithTimeout(context.Background(), storeTimeout)
+	defer cancel()
+
+	if err := dm.store.SaveIdentity(ctx, identity.Fingerprint, identity.PublicKey); err != nil {
+		slog.Error("Failed to save identity", "identity", identity.Fingerprint, "error", err)
+		return
+	}
+	pending, err := dm.store.PendingDirect(ctx, identity.Fingerprint, maxPendingDirect)
+	if err != nil && !errors.Is(err, database.ErrNotFound) {
+		slog.Error("Failed to load queued direct messages", "identity", identity.Fingerprint, "error", err)
+		return
+	}
+	for _, record := range pending {
+		if msg, ok := decodeDirect(record); ok {
+			dm.enqueue(client, msg, dm.slowConsumer)
+		}
+	}
+}
+
+func (dm *DefaultManager) handleDirectAck(client *models.Client, payload json.RawMessage) {
+	var ack models.DirectAck
+	if err := json.Unmarshal(payload, &ack); err != nil || len(ack.IDs) == 0 {
+		return
+	}
+	recipient := client.IdentityFingerprint()
+	if recipient == "" {
+		dm.sendSystemMessage(client, "error", "register an identity first")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), storeTimeout)
+	defer cancel()
+	if err := dm.store.AckDirect(ctx, recipient, ack.IDs); err != nil {
+		slog.Error("Failed to acknowledge direct messages", "identity", recipient, "error", err)
+	}
+}
+
+func decodeDirect(record database.DirectMessage) (models.Message, bool) {
+	var msg models.Message
+	if err := json.Unmarshal(record.Content, &msg); err != nil {
+		slog.Warn("Invalid queued direct message", "id", record.ID, "error", err)
+		return models.Message{}, false
+	}
+	msg.ID = record.ID
+	return msg, true
+}
@@ -0,0 +1,251 @@
+package websocket
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"slices"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/fromscript/hush/internal/crypto"
+	"github.com/fromscript/hush/internal/database"
+	"github.com/fromscript/hush/internal/websocket/models"
+)
+
+// "edit", "delete" and "react" frames reference a stored room message by its
+// ID. Only the message's author, its identity or else its session, may edit
+// or delete it. Changes are applied to the stored message and relayed to the
+// room as events of the same type carrying that ID.
+
+const (
+	maxEmojiLength = 32 // bytes
+	maxReactions   = 32 // distinct emoji per message
+)
+
+var (
+	errNotAuthor     = errors.New("only the sender can change a message")
+	errNotEditable   = errors.New("only messages can be edited")
+	errTooManyEmoji  = errors.New("too many reactions on this message")
+	errNothingToDo   = errors.New("unchanged")
+	errInvalidStored = errors.New("stored message is not a frame")
+)
+
+func (dm *DefaultManager) handleEdit(client *models.Client, msg models.Message) {
+	room, ok := dm.editableRoom(client, msg)
+	if !ok {
+		return
+	}
+	if room.Muted(client) {
+		dm.sendSystemMessage(client, "error", "you are muted in this room")
+		return
+	}
+	if !dm.authenticateEdit(client, room, &msg) {
+		return
+	}
+	if staleEpoch(room, msg) {
+		dm.sendEvent(client, "stale_epoch", models.RekeyMessage{RoomID: room.ID, Epoch: room.Epoch()})
+		return
+	}
+
+	edited, err := dm.updateMessage(room.ID, msg.ID, func(record *database.Message, frame *models.Message) error {
+		if !isAuthor(client, record.Author) {
+			return errNotAuthor
+		}
+		if frame.Type != "message" {
+			return errNotEditable
+		}
+		frame.Payload = msg.Payload
+		frame.Epoch = msg.Epoch
+		frame.Signature = msg.Signature
+		frame.Sender = msg.Sender
+		frame.EditedAt = time.Now().UnixMilli()
+		return nil
+	})
+	if err != nil {
+		dm.rejectChange(client, room.ID, msg.ID, err)
+		return
+	}
+
+	// The edited frame itself is the event; without a sequence it is not
+	// mistaken for a new room message
+	edited.Type = "edit"
+	edited.Seq = 0
+	room.Touch()
+	dm.broadcastToRoom(room.ID, edited)
+}
+
+func (dm *DefaultManager) handleDelete(client *models.Client, msg models.Message) {
+	room, ok := dm.editableRoom(client, msg)
+	if !ok {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), storeTimeout)
+	defer cancel()
+	record, err := dm.store.Message(ctx, room.ID, msg.ID)
+	if err == nil && !isAuthor(client, record.Author) {
+		err = errNotAuthor
+	}
+	if err == nil {
+		err = dm.store.DeleteMessage(ctx, room.ID, msg.ID)
+	}
+	if err != nil {
+		dm.rejectChange(client, room.ID, msg.ID, err)
+		return
+	}
+
+	slog.Info("Message deleted", "session", client.SessionID, "room", room.ID, "id", msg.ID)
+	event := newEvent("delete", nil)
+	event.ID = msg.ID
+	room.Touch()
+	dm.broadcastToRoom(room.ID, event)
+}
+
+func (dm *DefaultManager) handleReact(client *models.Client, msg models.Message) {
+	room, ok := dm.editableRoom(client, msg)
+	if !ok {
+		return
+	}
+	if room.Muted(client) {
+		dm.sendSystemMessage(client, "error", "you are muted in this room")
+		return
+	}
+	var reaction models.Reaction
+	if err := json.Unmarshal(msg.Payload, &reaction); err != nil || !validEmoji(reaction.Emoji) {
+		dm.sendSystemMessage(client, "error", "invalid reaction")
+		return
+	}
+	// Handles can be chosen freely, so they cannot tell reactors apart
+	reaction.Reactor = client.IdentityFingerprint()
+	if reaction.Reactor == "" {
+		reaction.Reactor = models.MemberID(room.ID, client.SessionID)
+	}
+
+	_, err := dm.updateMessage(room.ID, msg.ID, func(_ *database.Message, frame *models.Message) error {
+		return applyReaction(frame, reaction)
+	})
+	if errors.Is(err, errNothingToDo) {
+		return
+	}
+	if err != nil {
+		dm.rejectChange(client, room.ID, msg.ID, err)
+		return
+	}
+
+	event := newEvent("react", reaction)
+	event.ID = msg.ID
+	dm.broadcastToRoom(room.ID, event)
+}
+
+// editableRoom returns the room a change to msg.ID applies to.
+func (dm *DefaultManager) editableRoom(client *models.Client, msg models.Message) (*models.Room, bool) {
+	room, ok := dm.currentRoom(client)
+	if !ok {
+		dm.sendSystemMessage(client, "error", "join a room first")
+		return nil, false
+	}
+	if msg.ID == "" {
+		dm.sendSystemMessage(client, "error", "missing message ID")
+		return nil, false
+	}
+	return room, true
+}
+
+// authenticateEdit is authenticate for the new payload of an edited message.
+func (dm *DefaultManager) authenticateEdit(client *models.Client, room *models.Room, msg *models.Message) bool {
+	msg.Sender = ""
+	identity := client.Identity()
+	if identity == nil {
+		msg.Signature = nil
+		return true
+	}
+
+	input := crypto.EditSigningInput(room.ID, msg.ID, msg.Epoch, msg.Payload)
+	if err := crypto.Verify(identity.PublicKey, input, msg.Signature); err != nil {
+		slog.Info("Rejected unsigned or forged edit", "session", client.SessionID, "room", room.ID)
+		dm.sendSystemMessage(client, "error", "message signature does not verify")
+		return false
+	}
+	msg.Sender = identity.Fingerprint
+	return true
+}
+
+// updateMessage applies change to the frame of a stored message and returns
+// the updated frame.
+func (dm *DefaultManager) updateMessage(roomID, id string, change func(*database.Message, *models.Message) error) (models.Message, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), storeTimeout)
+	defer cancel()
+
+	var updated models.Message
+	err := dm.store.UpdateMessage(ctx, roomID, id, func(record *database.Message) error {
+		var frame models.Message
+		if err := json.Unmarshal(record.Content, &frame); err != nil {
+			return errInvalidStored
+		}
+		if err := change(record, &frame); err != nil {
+			return err
+		}
+		content, err := json.Marshal(frame)
+		if err != nil {
+			return err
+		}
+		record.Content = content
+		frame.ID = record.ID
+		frame.Seq = record.Seq
+		updated = frame
+		return nil
+	})
+	return updated, err
+}
+
+func (dm *DefaultManager) rejectChange(client *models.Client, roomID, id string, err error) {
+	switch {
+	case errors.Is(err, database.ErrNotFound):
+		dm.sendSystemMessage(client, "error", "message not found")
+	case errors.Is(err, errNotAuthor), errors.Is(err, errNotEditable), errors.Is(err, errTooManyEmoji):
+		dm.sendSystemMessage(client, "error", err.Error())
+	default:
+		slog.Error("Failed to change message", "session", client.SessionID, "room", roomID, "id", id, "error", err)
+		dm.sendSystemMessage(client, "error", "message could not be changed")
+	}
+}
+
+// isAuthor matches the author stored with a message, which is the sender's
+// identity fingerprint or, without one, its session ID.
+func isAuthor(client *models.Client, author string) bool {
+	return author != "" && (author == client.SessionID || author == client.IdentityFingerprint())
+}
+
+func applyReaction(frame *models.Message, reaction models.Reaction) error {
+	reactors := frame.Reactions[reaction.Emoji]
+	i := slices.Index(reactors, reaction.Reactor)
+	switch {
+	case reaction.Remove && i < 0, !reaction.Remove && i >= 0:
+		return errNothingToDo
+	case reaction.Remove:
+		reactors = slices.Delete(reactors, i, i+1)
+	case reactors == nil && len(frame.Reactions) >= maxReactions:
+		return errTooManyEmoji
+	default:
+		reactors = append(reactors, reaction.Reactor)
+	}
+
+	if len(reactors) == 0 {
+		delete(frame.Reactions, reaction.Emoji)
+		return nil
+	}
+	if frame.Reactions == nil {
+		frame.Reactions = make(map[string][]string)
+	}
+	frame.Reactions[reaction.Emoji] = reactors
+	return nil
+}
+
+func validEmoji(emoji string) bool {
+	return emoji != "" && len(emoji) <= maxEmojiLength && utf8.ValidString(emoji) &&
+		!strings.ContainsFunc(emoji, unicode.IsControl)
+}
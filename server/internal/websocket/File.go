@@ -0,0 +1,282 @@
+package websocket
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/fromscript/hush/internal/database"
+	"github.com/fromscript/hush/internal/websocket/models"
+)
+
+// Files are uploaded to a room in chunks: "file_begin" declares the size,
+// "file_chunk" frames append ciphertext at the offset the server last
+// acknowledged, and "file_end" announces the file to the room with a "file"
+// frame that is stored and sequenced like a message. Only received
+// bytes count against the room's quota, so a declared size reserves nothing.
+// An interrupted upload resumes with "file_begin" naming its file ID, unless
+// it stalled for longer than staleUploadTimeout and was deleted. Members
+// download with "file_get", one chunk per request. Files are deleted together
+// with their room.
+
+const (
+	maxFileChunk         = 256 * 1024 // well below maxMessageSize once base64-encoded
+	maxFileMetadata      = 2048
+	defaultRoomFileQuota = 100 * 1024 * 1024
+	staleUploadTimeout   = 30 * time.Minute
+)
+
+func (dm *DefaultManager) handleFileBegin(client *models.Client, payload json.RawMessage) {
+	room, ok := dm.fileRoom(client)
+	if !ok {
+		return
+	}
+	var req models.FileBegin
+	if err := json.Unmarshal(payload, &req); err != nil {
+		dm.sendSystemMessage(client, "error", "invalid file upload")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), storeTimeout)
+	defer cancel()
+
+	if req.FileID != "" {
+		file, err := dm.ownFile(ctx, client, room.ID, req.FileID)
+		if err != nil {
+			dm.rejectFile(client, room.ID, err)
+			return
+		}
+		if file.Complete {
+			dm.sendSystemMessage(client, "error", "upload already finished")
+			return
+		}
+		dm.sendEvent(client, "file_ready", models.FileReady{FileID: file.ID, Offset: file.Received, Size: file.Size})
+		return
+	}
+
+	if room.Muted(client) {
+		dm.sendSystemMessage(client, "error", "you are muted in this room")
+		return
+	}
+	if req.Size <= 0 || req.Size > dm.fileQuota || len(req.Metadata) > maxFileMetadata {
+		dm.sendSystemMessage(client, "error", "invalid file size or metadata")
+		return
+	}
+	id, err := generateMessageID()
+	if err != nil {
+		slog.Error("Failed to generate file ID", "error", err)
+		return
+	}
+	file := &database.File{
+		ID:       id,
+		RoomID:   room.ID,
+		Owner:    owner(client),
+		Metadata: req.Metadata,
+		Size:     req.Size,
+	}
+	if err := dm.files.CreateFile(ctx, file, dm.fileQuota); err != nil {
+		dm.rejectFile(client, room.ID, err)
+		return
+	}
+	slog.Info("File upload started", "session", client.SessionID, "room", room.ID, "file", id, "size", req.Size)
+	dm.sendEvent(client, "file_ready", models.FileReady{FileID: id, Size: req.Size})
+}
+
+func (dm *DefaultManager) handleFileChunk(client *models.Client, payload json.RawMessage) {
+	room, ok := dm.fileRoom(client)
+	if !ok {
+		return
+	}
+	if room.Muted(client) {
+		dm.sendSystemMessage(client, "error", "you are muted in this room")
+		return
+	}
+	var chunk models.FileChunk
+	if err := json.Unmarshal(payload, &chunk); err != nil || len(chunk.Data) == 0 || len(chunk.Data) > maxFileChunk {
+		dm.sendSystemMessage(client, "error", "invalid file chunk")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), storeTimeout)
+	defer cancel()
+
+	file, err := dm.ownFile(ctx, client, room.ID, chunk.FileID)
+	if err != nil {
+		dm.rejectFile(client, room.ID, err)
+		return
+	}
+	received, err := dm.files.AppendChunk(ctx, room.ID, file.ID, chunk.Offset, chunk.Data, dm.fileQuota)
+	if errors.Is(err, database.ErrBadOffset) {
+		// Tells the client where to continue from
+		dm.sendEvent(client, "file_ready", models.FileReady{FileID: file.ID, Offset: received, Size: file.Size})
+		return
+	}
+	if err != nil {
+		dm.rejectFile(client, room.ID, err)
+		return
+	}
+	dm.sendEvent(client, "file_ack", models.FileReady{FileID: file.ID, Offset: received, Size: file.Size})
+}
+
+func (dm *DefaultManager) handleFileEnd(client *models.Client, payload json.RawMessage) {
+	room, ok := dm.fileRoom(client)
+	if !ok {
+		return
+	}
+	if room.Muted(client) {
+		dm.sendSystemMessage(client, "error", "you are muted in this room")
+		return
+	}
+	var req models.FileRequest
+	if err := json.Unmarshal(payload, &req); err != nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), storeTimeout)
+	defer cancel()
+
+	file, err := dm.ownFile(ctx, client, room.ID, req.FileID)
+	if err == nil {
+		err = dm.files.CompleteFile(ctx, room.ID, file.ID)
+	}
+	if err != nil {
+		dm.rejectFile(client, room.ID, err)
+		return
+	}
+
+	slog.Info("File uploaded", "session", client.SessionID, "room", room.ID, "file", file.ID, "size", file.Size)
+	announcement := newEvent("file", models.FileMessage{
+		RoomID:   room.ID,
+		FileID:   file.ID,
+		Size:     file.Size,
+		Metadata: file.Metadata,
+		Sender:   client.IdentityFingerprint(),
+		Handle:   client.Handle(),
+	})
+	announcement.Handle = client.Handle()
+	announcement.Origin = client.SessionID
+
+	room.Sequencer.Lock()
+	defer room.Sequencer.Unlock()
+	if err := dm.persistMessage(room.ID, &announcement); err != nil {
+		slog.Error("Failed to persist file announcement", "session", client.SessionID, "room", room.ID, "error", err)
+		dm.sendSystemMessage(client, "error", "file could not be announced")
+		return
+	}
+	room.Touch()
+	// Unlike a message, the uploader gets the announcement too
+	announcement.Origin = ""
+	dm.broadcastToRoom(room.ID, announcement)
+}
+
+func (dm *DefaultManager) handleFileGet(client *models.Client, payload json.RawMessage) {
+	room, ok := dm.fileRoom(client)
+	if !ok {
+		return
+	}
+	var req models.FileRequest
+	if err := json.Unmarshal(payload, &req); err != nil || req.Offset < 0 {
+		dm.sendSystemMessage(client, "error", "invalid file request")
+		return
+	}
+	length := req.Length
+	if length <= 0 || length > maxFileChunk {
+		length = maxFileChunk
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), storeTimeout)
+	defer cancel()
+
+	file, err := dm.files.File(ctx, room.ID, req.FileID)
+	if err != nil {
+		dm.rejectFile(client, room.ID, err)
+		return
+	}
+	data, err := dm.files.ReadChunk(ctx, room.ID, file.ID, req.Offset, length)
+	if err != nil {
+		dm.rejectFile(client, room.ID, err)
+		return
+	}
+	dm.sendEvent(client, "file_chunk", models.FileChunk{
+		FileID: file.ID,
+		Offset: req.Offset,
+		Data:   data,
+		EOF:    req.Offset+int64(len(data)) >= file.Size,
+	})
+}
+
+// fileRoom returns the room file frames apply to, if file transfer is on.
+func (dm *DefaultManager) fileRoom(client *models.Client) (*models.Room, bool) {
+	if dm.files == nil {
+		dm.sendSystemMessage(client, "error", "file transfer is not enabled")
+		return nil, false
+	}
+	room, ok := dm.currentRoom(client)
+	if !ok {
+		dm.sendSystemMessage(client, "error", "join a room first")
+		return nil, false
+	}
+	return room, true
+}
+
+// ownFile returns an upload of the client's.
+func (dm *DefaultManager) ownFile(ctx context.Context, client *models.Client, roomID, id string) (database.File, error) {
+	file, err := dm.files.File(ctx, roomID, id)
+	if err != nil {
+		return database.File{}, err
+	}
+	if !isAuthor(client, file.Owner) {
+		return database.File{}, database.ErrNotFound
+	}
+	return file, nil
+}
+
+func (dm *DefaultManager) rejectFile(client *models.Client, roomID string, err error) {
+	switch {
+	case errors.Is(err, database.ErrNotFound):
+		dm.sendSystemMessage(client, "error", "file not found")
+	case errors.Is(err, database.ErrQuotaExceeded), errors.Is(err, database.ErrIncomplete):
+		dm.sendSystemMessage(client, "error", err.Error())
+	default:
+		slog.Error("File transfer failed", "session", client.SessionID, "room", roomID, "error", err)
+		dm.sendSystemMessage(client, "error", "file transfer failed")
+	}
+}
+
+// deleteRoomFiles removes the files of a deleted room.
+func (dm *DefaultManager) deleteRoomFiles(ctx context.Context, roomID string) {
+	if dm.files == nil {
+		return
+	}
+	if err := dm.files.DeleteRoomFiles(ctx, roomID); err != nil {
+		slog.Error("Failed to delete room files", "room", roomID, "error", err)
+	}
+}
+
+// expireUploads deletes uploads that stalled, so abandoned ones stop counting
+// against their room's quota.
+func (dm *DefaultManager) expireUploads(ctx context.Context, now time.Time) {
+	if dm.files == nil {
+		return
+	}
+	storeCtx, cancel := context.WithTimeout(ctx, storeTimeout)
+	defer cancel()
+	deleted, err := dm.files.DeleteStaleUploads(storeCtx, now.Add(-staleUploadTimeout))
+	if err != nil {
+		slog.Error("Failed to delete stale uploads", "error", err)
+		return
+	}
+	if deleted > 0 {
+		slog.Info("Deleted stale uploads", "count", deleted)
+	}
+}
+
+// owner identifies a client across reconnects, like the author of a message.
+func owner(client *models.Client) string {
+	if fingerprint := client.IdentityFingerprint(); fingerprint != "" {
+		return fingerprint
+	}
+	return client.SessionID
+}
@@ -0,0 +1,73 @@
+package websocket
+
+import (
+	"encoding/json"
+	"log/slog"
+
+	"github.com/fromscript/hush/internal/crypto"
+	"github.com/fromscript/hush/internal/websocket/models"
+)
+
+// Clients may register an Ed25519 identity key by signing their session
+// challenge. From then on every room message must be signed with it, and the
+// server stamps the verified key fingerprint as the sender. The server never
+// learns who is behind a key.
+
+// handleIdentity verifies the proof of possession and registers the key for
+// the rest of the connection.
+func (dm *DefaultManager) handleIdentity(client *models.Client, payload json.RawMessage) {
+	var req models.IdentityMessage
+	if err := json.Unmarshal(payload, &req); err != nil {
+		dm.sendSystemMessage(client, "error", "invalid identity")
+		return
+	}
+	publicKey, err := crypto.ParseIdentityKey(req.PublicKey)
+	if err != nil {
+		dm.sendSystemMessage(client, "error", "invalid Ed25519 public key")
+		return
+	}
+	if err := crypto.Verify(publicKey, crypto.IdentityProof(client.SessionID, client.Challenge), req.Signature); err != nil {
+		dm.sendSystemMessage(client, "error", "identity proof does not verify")
+		return
+	}
+
+	identity := &models.Identity{PublicKey: publicKey, Fingerprint: crypto.Fingerprint(publicKey)}
+	if !client.SetIdentity(identity) {
+		dm.sendSystemMessage(client, "error", "identity already registered")
+		return
+	}
+	slog.Info("Identity registered", "session", client.SessionID, "identity", identity.Fingerprint)
+	dm.sendEvent(client, "identity", models.IdentityMessage{PublicKey: identity.PublicKey, Fingerprint: identity.Fingerprint})
+	dm.flushDirect(client, identity)
+
+	room, ok := dm.currentRoom(client)
+	if !ok {
+		return
+	}
+	if dm.expelIfBanned(room, client) {
+		return
+	}
+	dm.announcePresence(room.ID, client, "identified")
+}
+
+// authenticate checks the signature of a room message from a client with an
+// identity and stamps the sender. Messages from clients without one carry
+// no sender. It runs after resolveThread, so the signature covers the reply
+// and thread IDs as relayed.
+func (dm *DefaultManager) authenticate(client *models.Client, room *models.Room, msg *models.Message) bool {
+	msg.Sender = ""
+	identity := client.Identity()
+	if identity == nil {
+		msg.Signature = nil
+		return true
+	}
+
+	input := crypto.MessageSigningInput(room.ID, msg.Epoch, msg.TTL, msg.ReplyTo, msg.ThreadID, msg.Payload)
+	if err := crypto.Verify(identity.PublicKey, input, msg.Signature); err != nil {
+		slog.Info("Rejected unsigned or forged message", "session", client.SessionID, "room", room.ID)
+		dm.sendSystemMessage(client, "error", "message signature does not verify")
+		return false
+	}
+	msg.Sender = identity.Fingerprint
+	return true
+}
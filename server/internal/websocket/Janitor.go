@@ -0,0 +1,94 @@
+package websocket
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/fromscript/hush/internal/websocket/models"
+)
+
+// runJanitor drops empty rooms from memory, deletes rooms that have been idle
+// for longer than the configured room expiry, deletes stalled uploads and
+// forgets suspended sessions whose resume window has passed.
+func (dm *DefaultManager) runJanitor(ctx context.Context) {
+	ticker := time.NewTicker(janitorInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			dm.collectRooms(ctx)
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (dm *DefaultManager) collectRooms(ctx context.Context) {
+	now := time.Now()
+	dm.purgeSuspendedSessions(now)
+	dm.expireUploads(ctx, now)
+
+	dm.rooms.Range(func(_, value interface{}) bool {
+		room := value.(*models.Room)
+		switch {
+		case dm.roomExpiry > 0 && room.IdleFor(now) > dm.roomExpiry:
+			dm.expireRoom(ctx, room)
+		case room.CloseIfEmpty():
+			dm.dropRoom(room)
+		}
+		return true
+	})
+
+	if dm.roomExpiry <= 0 {
+		return
+	}
+
+	// Rooms nobody is connected to are only known to the store
+	storeCtx, cancel := context.WithTimeout(ctx, storeTimeout)
+	defer cancel()
+	deleted, err := dm.store.DeleteIdleRooms(storeCtx, dm.roomExpiry)
+	if err != nil {
+		slog.Error("Failed to delete idle rooms", "error", err)
+		return
+	}
+	for _, roomID := range deleted {
+		dm.deleteRoomFiles(storeCtx, roomID)
+	}
+	if len(deleted) > 0 {
+		slog.Info("Deleted idle rooms", "count", len(deleted))
+	}
+}
+
+func (dm *DefaultManager) dropRoom(room *models.Room) {
+	if !dm.rooms.CompareAndDelete(room.ID, room) {
+		return
+	}
+	dm.metrics.SetRoomCount(int(dm.roomCount.Add(-1)))
+	if err := dm.bus.Unsubscribe(room.ID); err != nil {
+		slog.Warn("Failed to unsubscribe from room", "room", room.ID, "error", err)
+	}
+}
+
+func (dm *DefaultManager) expireRoom(ctx context.Context, room *models.Room) {
+	members := room.Close()
+	dm.dropRoom(room)
+
+	event := models.RoomExpiredMessage{RoomID: room.ID}
+	for _, client := range members {
+		dm.sendEvent(client, "room_expired", event)
+	}
+	room.Suspended.Range(func(_, value interface{}) bool {
+		value.(*models.SuspendedSession).Detach(newEvent("room_expired", event))
+		return true
+	})
+
+	storeCtx, cancel := context.WithTimeout(ctx, storeTimeout)
+	defer cancel()
+	if err := dm.store.DeleteRoom(storeCtx, room.ID); err != nil {
+		slog.Error("Failed to delete expired room", "room", room.ID, "error", err)
+	}
+	dm.deleteRoomFiles(storeCtx, room.ID)
+	slog.Info("Room expired", "room", room.ID, "members", len(members))
+}
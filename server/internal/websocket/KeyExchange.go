@@ -0,0 +1,87 @@
+package websocket
+
+import (
+	"encoding/json"
+
+	"github.com/fromscript/hush/internal/crypto"
+	"github.com/fromscript/hush/internal/websocket/models"
+)
+
+// The server only relays key exchange traffic: public keys are checked for
+// validity, room keys travel sealed to their recipient.
+
+const maxKeyShareSize = 4096
+
+// handleKeyBundle registers the client's public key and announces it to the
+// room, so members can seal the room key for it.
+func (dm *DefaultManager) handleKeyBundle(client *models.Client, payload json.RawMessage) {
+	var bundle models.KeyBundle
+	if err := json.Unmarshal(payload, &bundle); err != nil {
+		dm.sendSystemMessage(client, "error", "invalid key bundle")
+		return
+	}
+	if _, err := crypto.ParsePublicKey(bundle.PublicKey); err != nil {
+		dm.sendSystemMessage(client, "error", "invalid X25519 public key")
+		return
+	}
+	bundle.Fingerprint = crypto.Fingerprint(bundle.PublicKey)
+	client.SetKeyBundle(&bundle)
+
+	if room, ok := dm.currentRoom(client); ok && !dm.expelIfBanned(room, client) {
+		dm.broadcastEvent(room.ID, "key_bundle", bundle)
+	}
+}
+
+// handleKeyRequest asks the other members of the room to share the room key
+// with the requesting client.
+func (dm *DefaultManager) handleKeyRequest(client *models.Client) {
+	bundle := client.KeyBundle()
+	if bundle == nil {
+		dm.sendSystemMessage(client, "error", "publish a key bundle first")
+		return
+	}
+	room, ok := dm.currentRoom(client)
+	if !ok {
+		dm.sendSystemMessage(client, "error", "join a room first")
+		return
+	}
+	dm.broadcastEvent(room.ID, "key_request", bundle)
+}
+
+// handleKeyShare relays a sealed room key to the member it is addressed to.
+func (dm *DefaultManager) handleKeyShare(client *models.Client, payload json.RawMessage) {
+	var share models.KeyShare
+	if err := json.Unmarshal(payload, &share); err != nil || share.To == "" || len(share.Share) > maxKeyShareSize {
+		dm.sendSystemMessage(client, "error", "invalid key share")
+		return
+	}
+	share.From = client.Fingerprint()
+	if share.From == "" {
+		dm.sendSystemMessage(client, "error", "publish a key bundle first")
+		return
+	}
+	room, ok := dm.currentRoom(client)
+	if !ok {
+		dm.sendSystemMessage(client, "error", "join a room first")
+		return
+	}
+
+	event := newEvent("key_share", share)
+	event.Recipient = share.To
+	dm.broadcastToRoom(room.ID, event)
+}
+
+// sendKeyBundles tells a client that just joined about the key bundles of
+// the members already in the room, and them about the client's.
+func (dm *DefaultManager) sendKeyBundles(client *models.Client, room *models.Room) {
+	room.Members.Range(func(_, value interface{}) bool {
+		member := value.(*models.Client)
+		if bundle := member.KeyBundle(); bundle != nil && member != client {
+			dm.sendEvent(client, "key_bundle", bundle)
+		}
+		return true
+	})
+	if bundle := client.KeyBundle(); bundle != nil {
+		dm.broadcastEvent(room.ID, "key_bundle", bundle)
+	}
+}
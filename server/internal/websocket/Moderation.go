@@ -0,0 +1,169 @@
+package websocket
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"slices"
+	"time"
+
+	"github.com/fromscript/hush/internal/websocket/models"
+)
+
+// The room owner moderates. Kicks, bans and mutes target a member ID from
+// presence, a session ID or a key fingerprint. Bans and locks are kept in the
+// store so they outlast reconnects, mutes only last while the room is in
+// memory. Member and session IDs change with every new session, so a ban is
+// always stored against the member's key and members without one can only be
+// kicked.
+
+const (
+	defaultBanDuration    = 24 * time.Hour
+	defaultMuteDuration   = 10 * time.Minute
+	maxModerationDuration = 30 * 24 * time.Hour
+)
+
+var errNoBanKey = errors.New("this member has no key to ban, kick it instead")
+
+func (dm *DefaultManager) handleModeration(client *models.Client, action string, payload json.RawMessage) {
+	var req models.ModerationMessage
+	if len(payload) > 0 {
+		if err := json.Unmarshal(payload, &req); err != nil {
+			dm.sendSystemMessage(client, "error", "invalid moderation request")
+			return
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), storeTimeout)
+	defer cancel()
+	settings, ok := dm.ownedRoom(ctx, client)
+	if !ok {
+		return
+	}
+
+	event := models.ModerationMessage{RoomID: settings.RoomID, Action: action, Target: req.Target}
+	switch action {
+	case "kick", "ban", "mute":
+		if req.Target == "" || slices.Contains(client.RoomAliases(settings.RoomID), req.Target) {
+			dm.sendSystemMessage(client, "error", "invalid moderation target")
+			return
+		}
+	}
+
+	switch action {
+	case "ban":
+		target, err := dm.banTarget(settings.RoomID, req.Target)
+		if err != nil {
+			dm.sendSystemMessage(client, "error", err.Error())
+			return
+		}
+		event.Target = target
+		until := time.Now().Add(moderationDuration(req.Duration, defaultBanDuration))
+		if err := dm.store.BanFromRoom(ctx, settings.RoomID, target, until); err != nil {
+			slog.Error("Failed to store ban", "room", settings.RoomID, "error", err)
+			dm.sendSystemMessage(client, "error", "ban could not be stored")
+			return
+		}
+		event.Until = until.UnixMilli()
+	case "mute":
+		event.Until = time.Now().Add(moderationDuration(req.Duration, defaultMuteDuration)).UnixMilli()
+	case "lock", "unlock":
+		settings.Locked = action == "lock"
+		if err := dm.store.SaveRoomSettings(ctx, settings); err != nil {
+			slog.Error("Failed to save room settings", "room", settings.RoomID, "error", err)
+			dm.sendSystemMessage(client, "error", "room settings could not be saved")
+			return
+		}
+	}
+
+	slog.Info("Moderation action", "room", settings.RoomID, "action", action, "target", event.Target, "by", client.SessionID)
+	// Broadcast first, so kicked members still learn why
+	dm.broadcastEvent(settings.RoomID, "moderation", event)
+	dm.applyModeration(settings.RoomID, event)
+}
+
+// banTarget resolves the target of a ban to the key it is stored against.
+// Targets that match no member are taken to be key fingerprints.
+func (dm *DefaultManager) banTarget(roomID, target string) (string, error) {
+	value, ok := dm.rooms.Load(roomID)
+	if !ok {
+		return target, nil
+	}
+	key, member := value.(*models.Room).Key(target)
+	switch {
+	case !member:
+		return target, nil
+	case key == "":
+		return "", errNoBanKey
+	}
+	return key, nil
+}
+
+// applyModeration enforces a moderation event on this replica's members.
+func (dm *DefaultManager) applyModeration(roomID string, event models.ModerationMessage) {
+	value, ok := dm.rooms.Load(roomID)
+	if !ok {
+		return
+	}
+	room := value.(*models.Room)
+
+	switch event.Action {
+	case "kick", "ban":
+		removed := room.Remove(event.Target)
+		for _, suspended := range room.RemoveSuspended(event.Target) {
+			suspended.Detach(newEvent("moderation", event))
+		}
+		for _, client := range removed {
+			dm.announcePresence(roomID, client, "left")
+		}
+		if len(removed) > 0 {
+			dm.requireRekey(room, "leave")
+		}
+	case "mute":
+		room.Mute(event.Target, time.UnixMilli(event.Until))
+	}
+}
+
+// observeModeration applies moderation relayed from other replicas.
+func (dm *DefaultManager) observeModeration(roomID string, msg models.Message) {
+	if msg.Type != "moderation" {
+		return
+	}
+	var event models.ModerationMessage
+	if err := json.Unmarshal(msg.Payload, &event); err != nil {
+		return
+	}
+	dm.applyModeration(roomID, event)
+}
+
+// banned reports whether the client is banned from a room by any of its
+// aliases.
+func (dm *DefaultManager) banned(ctx context.Context, roomID string, client *models.Client) (bool, error) {
+	return dm.store.Banned(ctx, roomID, client.RoomAliases(roomID)...)
+}
+
+// expelIfBanned removes a member whose newly published key turns out to be
+// banned; bans by key only become visible once the key is known.
+func (dm *DefaultManager) expelIfBanned(room *models.Room, client *models.Client) bool {
+	ctx, cancel := context.WithTimeout(context.Background(), storeTimeout)
+	defer cancel()
+
+	banned, err := dm.banned(ctx, room.ID, client)
+	if err != nil {
+		slog.Error("Failed to check bans", "room", room.ID, "error", err)
+		return false
+	}
+	if banned {
+		dm.leaveRoom(room, client)
+		dm.denyJoin(client, room.ID, models.DeniedBanned)
+	}
+	return banned
+}
+
+func moderationDuration(seconds int64, fallback time.Duration) time.Duration {
+	if seconds <= 0 {
+		return fallback
+	}
+	return min(time.Duration(seconds)*time.Second, maxModerationDuration)
+}
@@ -0,0 +1,75 @@
+package websocket
+
+import (
+	"time"
+
+	"github.com/fromscript/hush/internal/cluster"
+	"github.com/fromscript/hush/internal/database"
+	"github.com/fromscript/hush/internal/metrics"
+	"github.com/fromscript/hush/internal/websocket/models"
+)
+
+type Option func(*DefaultManager)
+
+func WithMessageStore(store database.MessageStore) Option {
+	return func(dm *DefaultManager) {
+		dm.store = store
+	}
+}
+
+// WithFileStore enables file transfer. quota is how many bytes of files a
+// room may hold; zero uses the default of 100 MiB.
+func WithFileStore(files database.FileStore, quota int64) Option {
+	return func(dm *DefaultManager) {
+		dm.files = files
+		dm.fileQuota = quota
+	}
+}
+
+// WithBus relays room broadcasts to other replicas sharing the same bus.
+func WithBus(bus cluster.Bus) Option {
+	return func(dm *DefaultManager) {
+		dm.bus = bus
+	}
+}
+
+// WithRoomExpiry sets how long a room may stay without messages or joins
+// before it is deleted together with its history. Zero disables expiry;
+// empty rooms are still dropped from memory.
+func WithRoomExpiry(expiry time.Duration) Option {
+	return func(dm *DefaultManager) {
+		dm.roomExpiry = expiry
+	}
+}
+
+// WithResumeWindow sets how long a dropped session can be resumed. Zero
+// disables resumption.
+func WithResumeWindow(window time.Duration) Option {
+	return func(dm *DefaultManager) {
+		dm.resumeWindow = window
+	}
+}
+
+func WithMetricsCollector(collector metrics.Collector) Option {
+	return func(dm *DefaultManager) {
+		dm.metrics = collector
+	}
+}
+
+// WithSlowConsumerPolicy sets what happens when a client cannot keep up with
+// its room. The default is models.DropNewest.
+func WithSlowConsumerPolicy(policy models.SlowConsumerPolicy) Option {
+	return func(dm *DefaultManager) {
+		dm.slowConsumer = policy
+	}
+}
+
+// WithRoomSlowConsumerPolicy overrides the slow consumer policy for one room.
+func WithRoomSlowConsumerPolicy(roomID string, policy models.SlowConsumerPolicy) Option {
+	return func(dm *DefaultManager) {
+		if dm.roomPolicies == nil {
+			dm.roomPolicies = make(map[string]models.SlowConsumerPolicy)
+		}
+		dm.roomPolicies[roomID] = policy
+	}
+}
@@ -0,0 +1,107 @@
+package websocket
+
+import (
+	"crypto/rand"
+	"encoding/base32"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/fromscript/hush/internal/websocket/models"
+)
+
+// Presence only ever exposes display handles and per-room member IDs.
+// Rosters include members of other replicas as far as their presence events
+// have been seen here.
+
+const (
+	typingInterval  = 2 * time.Second
+	maxHandleLength = 32
+)
+
+var errInvalidHandle = errors.New("handles are 1 to 32 printable characters")
+
+// joinHandle validates the handle a join asks for, or makes one up for a
+// client that has none. An empty result keeps the client's current handle.
+func joinHandle(client *models.Client, requested string) (string, error) {
+	requested = strings.TrimSpace(requested)
+	if requested == "" && client.Handle() == "" {
+		return generateHandle()
+	}
+	if utf8.RuneCountInString(requested) > maxHandleLength || strings.IndexFunc(requested, unicode.IsControl) >= 0 {
+		return "", errInvalidHandle
+	}
+	return requested, nil
+}
+
+// leaveRoom removes client from room, announcing it and rekeying the room.
+func (dm *DefaultManager) leaveRoom(room *models.Room, client *models.Client) bool {
+	if !room.Members.CompareAndDelete(client.SessionID, client) {
+		return false
+	}
+	dm.announcePresence(room.ID, client, "left")
+	dm.requireRekey(room, "leave")
+	return true
+}
+
+func (dm *DefaultManager) announcePresence(roomID string, client *models.Client, status string) {
+	dm.broadcastEventFrom(client, roomID, "presence", models.PresenceMessage{
+		RoomID:   roomID,
+		Handle:   client.Handle(),
+		MemberID: models.MemberID(roomID, client.SessionID),
+		Status:   status,
+		Identity: client.Identity(),
+	})
+}
+
+func (dm *DefaultManager) handleRoster(client *models.Client) {
+	room, ok := dm.currentRoom(client)
+	if !ok {
+		dm.sendSystemMessage(client, "error", "join a room first")
+		return
+	}
+	dm.sendEvent(client, "roster", models.RosterMessage{RoomID: room.ID, Members: room.Roster()})
+}
+
+// handleTyping relays a typing notification to the room. Notifications are
+// never stored, and those arriving faster than typingInterval are dropped.
+func (dm *DefaultManager) handleTyping(client *models.Client) {
+	room, ok := dm.currentRoom(client)
+	if !ok || room.Muted(client) || !client.AllowTyping(time.Now(), typingInterval) {
+		return
+	}
+	dm.broadcastEventFrom(client, room.ID, "typing", models.PresenceMessage{
+		RoomID:   room.ID,
+		Handle:   client.Handle(),
+		MemberID: models.MemberID(room.ID, client.SessionID),
+		Status:   "typing",
+	})
+}
+
+// observePresence keeps track of members on other replicas.
+func (dm *DefaultManager) observePresence(roomID string, msg models.Message) {
+	if msg.Type != "presence" {
+		return
+	}
+	var presence models.PresenceMessage
+	if err := json.Unmarshal(msg.Payload, &presence); err != nil {
+		return
+	}
+	if room, ok := dm.rooms.Load(roomID); ok {
+		switch presence.Status {
+		case "joined", "left":
+			room.(*models.Room).ObservePresence(presence.MemberID, presence.Handle, presence.Status == "joined")
+		}
+	}
+}
+
+func generateHandle() (string, error) {
+	b := make([]byte, 5)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return "anon-" + strings.ToLower(base32.StdEncoding.EncodeToString(b)), nil
+}
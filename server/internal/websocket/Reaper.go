@@ -0,0 +1,48 @@
+package websocket
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/fromscript/hush/internal/websocket/models"
+)
+
+// runReaper periodically deletes self-destructed messages from the store and
+// tells the members of each affected room which message IDs to drop.
+func (dm *DefaultManager) runReaper(ctx context.Context) {
+	ticker := time.NewTicker(reaperInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			dm.reapExpiredMessages(ctx)
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (dm *DefaultManager) reapExpiredMessages(ctx context.Context) {
+	ctx, cancel := context.WithTimeout(ctx, storeTimeout)
+	defer cancel()
+
+	expired, err := dm.store.DeleteExpired(ctx, time.Now())
+	if err != nil {
+		slog.Error("Failed to delete expired messages", "error", err)
+		return
+	}
+	if len(expired) == 0 {
+		return
+	}
+
+	byRoom := make(map[string][]string)
+	for _, msg := range expired {
+		byRoom[msg.RoomID] = append(byRoom[msg.RoomID], msg.ID)
+	}
+	for roomID, ids := range byRoom {
+		dm.broadcastEvent(roomID, "expired", models.ExpiredMessage{RoomID: roomID, IDs: ids})
+	}
+	slog.Info("Reaped expired messages", "count", len(expired), "rooms", len(byRoom))
+}
@@ -0,0 +1,82 @@
+package websocket
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"time"
+
+	"github.com/fromscript/hush/internal/database"
+	"github.com/fromscript/hush/internal/websocket/models"
+)
+
+// Read markers are kept per member and room. Rather than relaying every
+// "read" frame, each replica periodically broadcasts the markers of the rooms
+// that changed on it, so a busy room gets one receipts event per interval.
+
+const (
+	receiptInterval = 2 * time.Second
+	maxReceipts     = 200
+)
+
+func (dm *DefaultManager) handleRead(client *models.Client, payload json.RawMessage) {
+	var read models.ReadMessage
+	if err := json.Unmarshal(payload, &read); err != nil || read.Seq <= 0 {
+		return
+	}
+	room, ok := dm.currentRoom(client)
+	if !ok {
+		return
+	}
+
+	// Like reactors, readers without an identity are shown by member ID,
+	// since handles can be chosen freely
+	reader := client.IdentityFingerprint()
+	if reader == "" {
+		reader = models.MemberID(room.ID, client.SessionID)
+	}
+	marker := database.ReadMarker{Member: reader, Reader: reader, Seq: read.Seq}
+
+	ctx, cancel := context.WithTimeout(context.Background(), storeTimeout)
+	defer cancel()
+	if err := dm.store.MarkRead(ctx, room.ID, marker); err != nil {
+		slog.Error("Failed to save read marker", "session", client.SessionID, "room", room.ID, "error", err)
+		return
+	}
+	dm.receiptsDue.Store(room.ID, struct{}{})
+}
+
+// runReceipts broadcasts the read markers of rooms with new reads.
+func (dm *DefaultManager) runReceipts(ctx context.Context) {
+	ticker := time.NewTicker(receiptInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			dm.receiptsDue.Range(func(key, _ interface{}) bool {
+				dm.receiptsDue.Delete(key)
+				dm.broadcastReceipts(ctx, key.(string))
+				return true
+			})
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (dm *DefaultManager) broadcastReceipts(ctx context.Context, roomID string) {
+	ctx, cancel := context.WithTimeout(ctx, storeTimeout)
+	defer cancel()
+
+	markers, err := dm.store.ReadMarkers(ctx, roomID, maxReceipts)
+	if err != nil {
+		slog.Error("Failed to load read markers", "room", roomID, "error", err)
+		return
+	}
+	receipts := models.ReceiptsMessage{RoomID: roomID, Readers: make([]models.ReadReceipt, 0, len(markers))}
+	for _, marker := range markers {
+		receipts.Readers = append(receipts.Readers, models.ReadReceipt{Reader: marker.Reader, Seq: marker.Seq})
+	}
+	dm.broadcastEvent(roomID, "receipts", receipts)
+}
@@ -0,0 +1,42 @@
+package websocket
+
+import (
+	"encoding/json"
+	"log/slog"
+
+	"github.com/fromscript/hush/internal/websocket/models"
+)
+
+// requireRekey advances the room epoch after a membership change and asks
+// every member to rotate its sender key.
+func (dm *DefaultManager) requireRekey(room *models.Room, reason string) {
+	epoch := room.NextEpoch()
+	dm.broadcastEvent(room.ID, "rekey_required", models.RekeyMessage{
+		RoomID: room.ID,
+		Epoch:  epoch,
+		Reason: reason,
+	})
+	slog.Debug("Rekey required", "room", room.ID, "epoch", epoch, "reason", reason)
+}
+
+// staleEpoch reports whether msg was encrypted for an epoch that has since
+// ended. Clients that do not use sender keys send no epoch and are let
+// through.
+func staleEpoch(room *models.Room, msg models.Message) bool {
+	return msg.Epoch != 0 && msg.Epoch < room.Epoch()
+}
+
+// observeRekey keeps the local epoch in step with rekeys relayed from other
+// replicas.
+func (dm *DefaultManager) observeRekey(roomID string, msg models.Message) {
+	if msg.Type != "rekey_required" {
+		return
+	}
+	var rekey models.RekeyMessage
+	if err := json.Unmarshal(msg.Payload, &rekey); err != nil {
+		return
+	}
+	if room, ok := dm.rooms.Load(roomID); ok {
+		room.(*models.Room).AdvanceEpoch(rekey.Epoch)
+	}
+}
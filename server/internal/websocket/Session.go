@@ -0,0 +1,139 @@
+package websocket
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"log/slog"
+	"time"
+
+	"github.com/fromscript/hush/internal/websocket/models"
+)
+
+// startSession hands the client a fresh resume token, replacing the one it
+// may have connected with.
+func (dm *DefaultManager) startSession(client *models.Client, resumed *models.SuspendedSession) {
+	token, err := generateResumeToken()
+	if err != nil {
+		slog.Error("Failed to generate resume token", "session", client.SessionID, "error", err)
+	} else {
+		client.ResumeToken = token
+		dm.resumeTokens.Store(token, client.SessionID)
+	}
+
+	client.Challenge = make([]byte, 32)
+	if _, err := rand.Read(client.Challenge); err != nil {
+		slog.Error("Failed to generate identity challenge", "session", client.SessionID, "error", err)
+	}
+
+	session := models.SessionMessage{
+		SessionID:    client.SessionID,
+		ResumeToken:  client.ResumeToken,
+		ResumeWindow: int64(dm.resumeWindow / time.Second),
+		Challenge:    client.Challenge,
+	}
+	if resumed == nil {
+		dm.sendEvent(client, "session", session)
+		return
+	}
+
+	client.SetHandle(resumed.Handle)
+	roomID, buffered, missed, ok := resumed.Resume()
+	session.Resumed = ok
+	session.Missed = missed
+	var denied string
+	if ok && roomID != "" && (client.AllowedRoom == "" || client.AllowedRoom == roomID) {
+		if _, denied = dm.readmit(client, roomID); denied == "" {
+			session.RoomID = roomID
+		}
+	}
+	dm.sendEvent(client, "session", session)
+
+	// The write pump has not started, so a blocking send could hang the
+	// handshake; the room's slow consumer policy decides instead
+	policy := dm.slowConsumerPolicy(roomID)
+	for _, msg := range buffered {
+		dm.enqueue(client, msg, policy)
+	}
+	if denied != "" {
+		dm.denyJoin(client, roomID, denied)
+	}
+	if session.RoomID != "" {
+		// The session was already admitted, so no member limit applies
+		if err := dm.joinRoom(client, session.RoomID, "", 0); err != nil {
+			slog.Warn("Failed to rejoin room", "session", client.SessionID, "room", session.RoomID, "error", err)
+		}
+	}
+	slog.Info("Session resumed", "session", client.SessionID, "room", session.RoomID, "buffered", len(buffered))
+}
+
+// suspendSession keeps a disconnected client's membership for the resume
+// window, buffering the traffic of its room.
+func (dm *DefaultManager) suspendSession(client *models.Client) {
+	if client.ResumeToken == "" || dm.resumeWindow <= 0 {
+		return
+	}
+
+	suspended := models.NewSuspendedSession(client, time.Now().Add(dm.resumeWindow), resumeBufferSize)
+	dm.suspended.Store(client.SessionID, suspended)
+	if roomID := client.RoomID(); roomID != "" {
+		if room, ok := dm.rooms.Load(roomID); ok {
+			room.(*models.Room).Suspended.Store(client.SessionID, suspended)
+		}
+	}
+}
+
+// takeSuspendedSession redeems a resume token. A session that is still
+// connected, typically because the drop has not been noticed yet, is
+// disconnected and suspended first so that the new connection takes over.
+func (dm *DefaultManager) takeSuspendedSession(token string) *models.SuspendedSession {
+	sessionID, ok := dm.resumeTokens.LoadAndDelete(token)
+	if !ok {
+		return nil
+	}
+
+	if live, ok := dm.clients.Load(sessionID); ok {
+		client := live.(*models.Client)
+		client.Conn.Close(NormalClosure, "Session resumed elsewhere")
+		dm.cleanupClient(client)
+	}
+
+	value, ok := dm.suspended.LoadAndDelete(sessionID)
+	if !ok {
+		return nil
+	}
+	suspended := value.(*models.SuspendedSession)
+	dm.forgetSuspendedSession(suspended)
+	if time.Now().After(suspended.ExpiresAt) {
+		return nil
+	}
+	return suspended
+}
+
+func (dm *DefaultManager) purgeSuspendedSessions(now time.Time) {
+	dm.suspended.Range(func(key, value interface{}) bool {
+		suspended := value.(*models.SuspendedSession)
+		if now.After(suspended.ExpiresAt) && dm.suspended.CompareAndDelete(key, suspended) {
+			dm.resumeTokens.CompareAndDelete(suspended.ResumeToken, suspended.SessionID)
+			dm.forgetSuspendedSession(suspended)
+		}
+		return true
+	})
+}
+
+func (dm *DefaultManager) forgetSuspendedSession(suspended *models.SuspendedSession) {
+	roomID := suspended.RoomID()
+	if roomID == "" {
+		return
+	}
+	if room, ok := dm.rooms.Load(roomID); ok {
+		room.(*models.Room).Suspended.CompareAndDelete(suspended.SessionID, suspended)
+	}
+}
+
+func generateResumeToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
@@ -0,0 +1,71 @@
+package websocket
+
+import (
+	"log/slog"
+	"time"
+
+	"github.com/coder/websocket"
+	"github.com/fromscript/hush/internal/websocket/models"
+)
+
+// SlowConsumerClosure is the close code sent to clients disconnected by the
+// slow consumer policy.
+const SlowConsumerClosure websocket.StatusCode = 4008
+
+// enqueue queues msg on the client's send channel, applying policy when the
+// queue is full. It reports whether msg was queued.
+func (dm *DefaultManager) enqueue(client *models.Client, msg models.Message, policy models.SlowConsumerPolicy) bool {
+	if client.Closed() {
+		return false
+	}
+	select {
+	case client.Send <- msg:
+		return true
+	default:
+	}
+
+	dm.metrics.RecordSlowConsumer(policy.Mode.String())
+	switch policy.Mode {
+	case models.DropOldest:
+		select {
+		case evicted := <-client.Send:
+			client.Deliveries.Track(evicted, false)
+		default:
+		}
+		select {
+		case client.Send <- msg:
+			return true
+		default:
+		}
+	case models.Disconnect:
+		dm.disconnectSlowConsumer(client)
+	case models.Block:
+		timer := time.NewTimer(policy.Deadline)
+		defer timer.Stop()
+		select {
+		case client.Send <- msg:
+			return true
+		case <-timer.C:
+			dm.disconnectSlowConsumer(client)
+		}
+	}
+
+	slog.Warn("Client buffer full", "session", client.SessionID, "policy", policy.Mode)
+	return false
+}
+
+func (dm *DefaultManager) disconnectSlowConsumer(client *models.Client) {
+	slog.Warn("Disconnecting slow consumer", "session", client.SessionID)
+	// Closing waits for the close handshake, which a stalled client may never
+	// complete, so do not hold up the broadcast
+	go client.Conn.Close(SlowConsumerClosure, "Slow consumer")
+}
+
+// slowConsumerPolicy returns the room's own policy, if configured, or the
+// manager's.
+func (dm *DefaultManager) slowConsumerPolicy(roomID string) models.SlowConsumerPolicy {
+	if policy, ok := dm.roomPolicies[roomID]; ok {
+		return policy
+	}
+	return dm.slowConsumer
+}
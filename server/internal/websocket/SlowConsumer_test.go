@@ -0,0 +1,154 @@
+package websocket
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/coder/websocket"
+	"github.com/fromscript/hush/internal/metrics"
+	"github.com/fromscript/hush/internal/websocket/models"
+)
+
+// slowClient returns a client whose one-message queue is already full, and
+// the peer end of its connection.
+func slowClient(t *testing.T) (*models.Client, *websocket.Conn) {
+	t.Helper()
+	accepted := make(chan *websocket.Conn, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := websocket.Accept(w, r, nil)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		accepted <- conn
+	}))
+	t.Cleanup(srv.Close)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	peer, _, err := websocket.Dial(ctx, "ws"+srv.URL[len("http"):], nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { peer.CloseNow() })
+
+	conn := <-accepted
+	t.Cleanup(func() { conn.CloseNow() })
+	client := &models.Client{
+		Conn:       conn,
+		SessionID:  "slow",
+		Send:       make(chan models.Message, 1),
+		Deliveries: models.NewDeliveryTracker(maxPendingDeliveries),
+	}
+	client.Send <- models.Message{Type: "message", Seq: 1}
+	return client, peer
+}
+
+// closeStatus waits for the server to close the peer's connection.
+func closeStatus(peer *websocket.Conn) websocket.StatusCode {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	_, _, err := peer.Read(ctx)
+	return websocket.CloseStatus(err)
+}
+
+func TestEnqueueSlowConsumer(t *testing.T) {
+	tests := []struct {
+		name   string
+		policy models.SlowConsumerPolicy
+		drain  bool // read the queue while enqueue is waiting
+		queued bool
+		// want is the queue afterwards and wantDue what is left to retry
+		want, wantDue []int64
+		closed        bool
+	}{
+		{
+			name:    "drop newest",
+			policy:  models.SlowConsumerPolicy{Mode: models.DropNewest},
+			want:    []int64{1},
+			wantDue: nil, // enqueue's callers track the dropped message
+		},
+		{
+			name:    "drop oldest",
+			policy:  models.SlowConsumerPolicy{Mode: models.DropOldest},
+			queued:  true,
+			want:    []int64{2},
+			wantDue: []int64{1},
+		},
+		{
+			name:   "disconnect",
+			policy: models.SlowConsumerPolicy{Mode: models.Disconnect},
+			want:   []int64{1},
+			closed: true,
+		},
+		{
+			name:   "block until there is room",
+			policy: models.SlowConsumerPolicy{Mode: models.Block, Deadline: 5 * time.Second},
+			drain:  true,
+			queued: true,
+			want:   []int64{2},
+		},
+		{
+			name:   "block past the deadline",
+			policy: models.SlowConsumerPolicy{Mode: models.Block, Deadline: 20 * time.Millisecond},
+			want:   []int64{1},
+			closed: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dm := &DefaultManager{metrics: &metrics.DefaultCollector{}}
+			client, peer := slowClient(t)
+			if tt.drain {
+				go func() {
+					time.Sleep(10 * time.Millisecond)
+					<-client.Send
+				}()
+			}
+
+			queued := dm.enqueue(client, models.Message{Type: "message", Seq: 2}, tt.policy)
+			if queued != tt.queued {
+				t.Errorf("queued = %v, want %v", queued, tt.queued)
+			}
+
+			var got []int64
+			for len(client.Send) > 0 {
+				got = append(got, (<-client.Send).Seq)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("queue %v, want %v", got, tt.want)
+			}
+
+			due, _ := client.Deliveries.Due(time.Now(), time.Minute, 3)
+			var dueSeqs []int64
+			for _, msg := range due {
+				dueSeqs = append(dueSeqs, msg.Seq)
+			}
+			if !slices.Equal(dueSeqs, tt.wantDue) {
+				t.Errorf("due %v, want %v", dueSeqs, tt.wantDue)
+			}
+
+			if tt.closed {
+				if status := closeStatus(peer); status != SlowConsumerClosure {
+					t.Errorf("close status %v, want %v", status, SlowConsumerClosure)
+				}
+			}
+		})
+	}
+}
+
+func TestEnqueueClosedClient(t *testing.T) {
+	dm := &DefaultManager{metrics: &metrics.DefaultCollector{}}
+	client := &models.Client{Send: make(chan models.Message, 1)}
+	client.MarkClosed()
+	if dm.enqueue(client, models.Message{Type: "message", Seq: 1}, models.SlowConsumerPolicy{}) {
+		t.Error("queued for a closed client")
+	}
+	if len(client.Send) != 0 {
+		t.Error("message queued")
+	}
+}
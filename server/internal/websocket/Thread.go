@@ -0,0 +1,101 @@
+package websocket
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+
+	"github.com/fromscript/hush/internal/database"
+	"github.com/fromscript/hush/internal/websocket/models"
+)
+
+// A thread is a stored room message and every reply to it, however deeply
+// nested. Clients may follow threads to receive only their messages instead
+// of the whole room, for as long as they stay connected to the room.
+
+const maxFollowedThreads = 32
+
+// resolveThread places a reply in the thread of the message it answers. A
+// thread ID without ReplyTo replies to the thread's first message.
+func (dm *DefaultManager) resolveThread(client *models.Client, roomID string, msg *models.Message) bool {
+	if msg.ReplyTo == "" {
+		msg.ReplyTo = msg.ThreadID
+	}
+	msg.ThreadID = ""
+	if msg.ReplyTo == "" {
+		return true
+	}
+
+	threadID, err := dm.threadOf(roomID, msg.ReplyTo)
+	if err != nil {
+		dm.rejectThread(client, roomID, err)
+		return false
+	}
+	msg.ThreadID = threadID
+	return true
+}
+
+// threadOf returns the thread a stored message starts or belongs to.
+func (dm *DefaultManager) threadOf(roomID, messageID string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), storeTimeout)
+	defer cancel()
+
+	record, err := dm.store.Message(ctx, roomID, messageID)
+	if err != nil {
+		return "", err
+	}
+	if record.ThreadID != "" {
+		return record.ThreadID, nil
+	}
+	return record.ID, nil
+}
+
+func (dm *DefaultManager) handleThreadHistory(client *models.Client, payload json.RawMessage) {
+	var req models.HistoryRequest
+	if err := json.Unmarshal(payload, &req); err != nil || req.ThreadID == "" || !dm.inRoom(client) {
+		return
+	}
+	dm.sendHistory(client, database.HistoryQuery{
+		Since:    req.Since,
+		Before:   req.Before,
+		Limit:    req.Limit,
+		ThreadID: req.ThreadID,
+	})
+}
+
+func (dm *DefaultManager) handleThreadSubscription(client *models.Client, subscribe bool, payload json.RawMessage) {
+	room, ok := dm.currentRoom(client)
+	if !ok {
+		dm.sendSystemMessage(client, "error", "join a room first")
+		return
+	}
+	var req models.ThreadSubscription
+	if err := json.Unmarshal(payload, &req); err != nil || req.ThreadID == "" {
+		return
+	}
+
+	if !subscribe {
+		client.UnfollowThread(req.ThreadID)
+	} else {
+		threadID, err := dm.threadOf(room.ID, req.ThreadID)
+		if err != nil {
+			dm.rejectThread(client, room.ID, err)
+			return
+		}
+		if !client.FollowThread(threadID, maxFollowedThreads) {
+			dm.sendSystemMessage(client, "error", "following too many threads")
+			return
+		}
+	}
+	dm.sendEvent(client, "threads", models.ThreadsMessage{RoomID: room.ID, ThreadIDs: client.Threads()})
+}
+
+func (dm *DefaultManager) rejectThread(client *models.Client, roomID string, err error) {
+	if errors.Is(err, database.ErrNotFound) {
+		dm.sendSystemMessage(client, "error", "message not found")
+		return
+	}
+	slog.Error("Failed to load thread", "session", client.SessionID, "room", roomID, "error", err)
+	dm.sendSystemMessage(client, "error", "thread unavailable")
+}
@@ -0,0 +1,8 @@
+package models
+
+// AckMessage acknowledges every message of the client's room up to and
+// including Seq. Once a client has acked, unacknowledged messages are resent
+// and, failing that, reported in a GapMessage.
+type AckMessage struct {
+	Seq int64 `json:"seq"`
+}
@@ -1,12 +1,207 @@
 package models
 
 import (
+	"crypto/sha256"
+	"encoding/base64"
+	"maps"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+
 	"github.com/coder/websocket"
 )
 
 type Client struct {
-	Conn      *websocket.Conn
-	SessionID string
-	Send      chan Message
-	RoomID    string
+	Conn        *websocket.Conn
+	SessionID   string
+	Send        chan Message
+	ResumeToken string
+	// AllowedRoom is set when the connection token is scoped to one room
+	AllowedRoom string
+	Deliveries  *DeliveryTracker
+	// Challenge is signed by the client to register its identity key
+	Challenge []byte
+
+	closed     atomic.Bool
+	roomID     atomic.Pointer[string]
+	keyBundle  atomic.Pointer[KeyBundle]
+	identity   atomic.Pointer[Identity]
+	handle     atomic.Pointer[string]
+	lastTyping atomic.Int64 // unix nanos
+
+	threadsMu sync.Mutex
+	threads   map[string]bool // followed thread IDs; none means the whole room
+}
+
+// MarkClosed reports whether this call was the one that closed the client.
+func (c *Client) MarkClosed() bool {
+	return c.closed.CompareAndSwap(false, true)
+}
+
+func (c *Client) Closed() bool {
+	return c.closed.Load()
+}
+
+// RoomID is the room the client last joined. Besides the client's own
+// goroutine, a takeover of its session may clear it.
+func (c *Client) RoomID() string {
+	if roomID := c.roomID.Load(); roomID != nil {
+		return *roomID
+	}
+	return ""
+}
+
+func (c *Client) SetRoomID(roomID string) {
+	c.roomID.Store(&roomID)
+}
+
+func (c *Client) KeyBundle() *KeyBundle {
+	return c.keyBundle.Load()
+}
+
+func (c *Client) SetKeyBundle(bundle *KeyBundle) {
+	c.keyBundle.Store(bundle)
+}
+
+// Fingerprint returns the fingerprint of the client's key bundle, if any.
+func (c *Client) Fingerprint() string {
+	if bundle := c.KeyBundle(); bundle != nil {
+		return bundle.Fingerprint
+	}
+	return ""
+}
+
+func (c *Client) Identity() *Identity {
+	return c.identity.Load()
+}
+
+// SetIdentity registers an identity once; it reports false if the client
+// already has one.
+func (c *Client) SetIdentity(identity *Identity) bool {
+	return c.identity.CompareAndSwap(nil, identity)
+}
+
+// IdentityFingerprint returns the fingerprint of the client's verified
+// identity key, if any.
+func (c *Client) IdentityFingerprint() string {
+	if identity := c.Identity(); identity != nil {
+		return identity.Fingerprint
+	}
+	return ""
+}
+
+// Key is the fingerprint that identifies the client beyond its session: its
+// identity key, or else its key bundle. It is empty for clients with neither.
+func (c *Client) Key() string {
+	if fingerprint := c.IdentityFingerprint(); fingerprint != "" {
+		return fingerprint
+	}
+	return c.Fingerprint()
+}
+
+// Aliases lists what moderation can target the client by: its session ID and
+// the fingerprints of its keys.
+func (c *Client) Aliases() []string {
+	aliases := []string{c.SessionID}
+	for _, fp := range []string{c.Fingerprint(), c.IdentityFingerprint()} {
+		if fp != "" {
+			aliases = append(aliases, fp)
+		}
+	}
+	return aliases
+}
+
+// RoomAliases adds the client's member ID in a room to its aliases.
+func (c *Client) RoomAliases(roomID string) []string {
+	return append(c.Aliases(), MemberID(roomID, c.SessionID))
+}
+
+// MemberID is the opaque ID presence and rosters show for a session in a
+// room, so owners can moderate members without learning session IDs. It is
+// derived rather than stored, so every replica agrees on it, and differs from
+// room to room.
+func MemberID(roomID, sessionID string) string {
+	sum := sha256.Sum256([]byte("hush member\x00" + roomID + "\x00" + sessionID))
+	return base64.RawURLEncoding.EncodeToString(sum[:12])
+}
+
+// Handle is the display name shown to other members in place of the session.
+func (c *Client) Handle() string {
+	if handle := c.handle.Load(); handle != nil {
+		return *handle
+	}
+	return ""
+}
+
+func (c *Client) SetHandle(handle string) {
+	c.handle.Store(&handle)
+}
+
+// AllowTyping reports whether a typing notification may be relayed now, at
+// most one per interval.
+func (c *Client) AllowTyping(now time.Time, interval time.Duration) bool {
+	last := c.lastTyping.Load()
+	if now.UnixNano()-last < int64(interval) {
+		return false
+	}
+	return c.lastTyping.CompareAndSwap(last, now.UnixNano())
+}
+
+// FollowThread limits the room messages the client receives to the threads it
+// follows. It reports false if the client already follows limit threads.
+func (c *Client) FollowThread(threadID string, limit int) bool {
+	c.threadsMu.Lock()
+	defer c.threadsMu.Unlock()
+
+	if c.threads == nil {
+		c.threads = make(map[string]bool)
+	}
+	if !c.threads[threadID] && len(c.threads) >= limit {
+		return false
+	}
+	c.threads[threadID] = true
+	return true
+}
+
+// UnfollowThread stops following a thread; once none are left the client
+// receives the whole room again.
+func (c *Client) UnfollowThread(threadID string) {
+	c.threadsMu.Lock()
+	defer c.threadsMu.Unlock()
+	delete(c.threads, threadID)
+}
+
+func (c *Client) ResetThreads() {
+	c.threadsMu.Lock()
+	defer c.threadsMu.Unlock()
+	c.threads = nil
+}
+
+// Threads returns the followed thread IDs in sorted order.
+func (c *Client) Threads() []string {
+	c.threadsMu.Lock()
+	defer c.threadsMu.Unlock()
+	return slices.Sorted(maps.Keys(c.threads))
+}
+
+// Wants reports whether a room frame should reach the client. Clients that
+// follow threads only get the messages and edits of those threads; every
+// other event reaches them as usual.
+func (c *Client) Wants(msg Message) bool {
+	if msg.Type != "message" && msg.Type != "edit" {
+		return true
+	}
+
+	c.threadsMu.Lock()
+	defer c.threadsMu.Unlock()
+
+	if len(c.threads) == 0 {
+		return true
+	}
+	thread := msg.ThreadID
+	if thread == "" {
+		thread = msg.ID
+	}
+	return c.threads[thread]
 }
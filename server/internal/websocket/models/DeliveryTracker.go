@@ -0,0 +1,137 @@
+package models
+
+import (
+	"cmp"
+	"slices"
+	"sync"
+	"time"
+)
+
+// DeliveryTracker remembers the room messages a client has not acknowledged
+// yet. Acks are cumulative: acking a sequence acks everything before it.
+// Clients opt in with their first ack; until then only messages that could
+// not be queued are tracked, and a message counts as delivered once written.
+type DeliveryTracker struct {
+	mu         sync.Mutex
+	acking     bool
+	roomID     string
+	acked      int64
+	pending    []pendingDelivery // ordered by sequence
+	maxPending int
+	gaps       []GapMessage
+}
+
+type pendingDelivery struct {
+	msg      Message
+	sentAt   time.Time // zero while the message could not be queued
+	attempts int
+}
+
+func NewDeliveryTracker(maxPending int) *DeliveryTracker {
+	return &DeliveryTracker{maxPending: maxPending}
+}
+
+// Reset starts tracking a new room, forgetting everything about the last one.
+func (t *DeliveryTracker) Reset(roomID string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.roomID = roomID
+	t.acked = 0
+	t.pending = nil
+	t.gaps = nil
+}
+
+// Track records a room message handed to the client. sent is false when the
+// client's queue was full; such messages are retried by Due.
+func (t *DeliveryTracker) Track(msg Message, sent bool) {
+	if msg.Seq == 0 {
+		return
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if msg.Seq <= t.acked || (sent && !t.acking) {
+		return
+	}
+	delivery := pendingDelivery{msg: msg}
+	if sent {
+		delivery.sentAt = time.Now()
+		delivery.attempts = 1
+	}
+
+	// Messages evicted from the queue come back here unsent
+	i, found := slices.BinarySearchFunc(t.pending, msg.Seq, func(d pendingDelivery, seq int64) int {
+		return cmp.Compare(d.msg.Seq, seq)
+	})
+	if found {
+		if !sent {
+			t.pending[i].sentAt = time.Time{}
+		}
+		return
+	}
+	t.pending = slices.Insert(t.pending, i, delivery)
+
+	if len(t.pending) > t.maxPending {
+		t.giveUp(t.pending[0].msg.Seq)
+		t.pending = t.pending[1:]
+	}
+}
+
+func (t *DeliveryTracker) Ack(seq int64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.acking = true
+	if seq <= t.acked {
+		return
+	}
+	t.acked = seq
+	i := 0
+	for i < len(t.pending) && t.pending[i].msg.Seq <= seq {
+		i++
+	}
+	t.pending = t.pending[i:]
+}
+
+// Due returns the messages to (re)send now and the gaps to report for
+// messages that ran out of attempts.
+func (t *DeliveryTracker) Due(now time.Time, timeout time.Duration, maxAttempts int) ([]Message, []GapMessage) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	var due []Message
+	kept := t.pending[:0]
+	for _, delivery := range t.pending {
+		if delivery.attempts > 0 && !t.acking {
+			continue
+		}
+		if !delivery.sentAt.IsZero() && now.Sub(delivery.sentAt) < timeout {
+			kept = append(kept, delivery)
+			continue
+		}
+		if delivery.attempts >= maxAttempts {
+			t.giveUp(delivery.msg.Seq)
+			continue
+		}
+		delivery.sentAt = now
+		delivery.attempts++
+		due = append(due, delivery.msg)
+		kept = append(kept, delivery)
+	}
+	t.pending = kept
+
+	gaps := t.gaps
+	t.gaps = nil
+	return due, gaps
+}
+
+// giveUp records seq as lost, merging it into the last gap when adjacent.
+func (t *DeliveryTracker) giveUp(seq int64) {
+	if n := len(t.gaps); n > 0 && t.gaps[n-1].To+1 == seq {
+		t.gaps[n-1].To = seq
+		return
+	}
+	t.gaps = append(t.gaps, GapMessage{RoomID: t.roomID, From: seq, To: seq})
+}
@@ -0,0 +1,128 @@
+package models
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestDeliveryTracker(t *testing.T) {
+	msg := func(seq int64) Message { return Message{Type: "message", Seq: seq} }
+	const (
+		timeout     = 10 * time.Second
+		maxAttempts = 2
+	)
+
+	tests := []struct {
+		name       string
+		maxPending int
+		run        func(t *DeliveryTracker, now time.Time) (due []Message, gaps []GapMessage)
+		wantDue    []int64
+		wantGaps   []GapMessage
+	}{
+		{
+			name: "seq 0 is not tracked",
+			run: func(t *DeliveryTracker, now time.Time) ([]Message, []GapMessage) {
+				t.Track(msg(0), false)
+				return t.Due(now, timeout, maxAttempts)
+			},
+		},
+		{
+			name: "sent messages need no ack until the client acks",
+			run: func(t *DeliveryTracker, now time.Time) ([]Message, []GapMessage) {
+				t.Track(msg(1), true)
+				return t.Due(now.Add(2*timeout), timeout, maxAttempts)
+			},
+		},
+		{
+			name: "unsent messages are retried",
+			run: func(t *DeliveryTracker, now time.Time) ([]Message, []GapMessage) {
+				t.Track(msg(1), false)
+				t.Track(msg(2), true)
+				return t.Due(now, timeout, maxAttempts)
+			},
+			wantDue: []int64{1},
+		},
+		{
+			name: "acks are cumulative",
+			run: func(t *DeliveryTracker, now time.Time) ([]Message, []GapMessage) {
+				t.Ack(0)
+				for seq := int64(1); seq <= 3; seq++ {
+					t.Track(msg(seq), true)
+				}
+				t.Ack(2)
+				t.Track(msg(1), false) // already acked
+				return t.Due(now.Add(2*timeout), timeout, maxAttempts)
+			},
+			wantDue: []int64{3},
+		},
+		{
+			name: "unacked messages wait for the timeout",
+			run: func(t *DeliveryTracker, now time.Time) ([]Message, []GapMessage) {
+				t.Ack(0)
+				t.Track(msg(1), true)
+				return t.Due(now.Add(timeout/2), timeout, maxAttempts)
+			},
+		},
+		{
+			name: "messages out of attempts become merged gaps",
+			run: func(t *DeliveryTracker, now time.Time) ([]Message, []GapMessage) {
+				t.Ack(0)
+				for _, seq := range []int64{1, 2, 4} {
+					t.Track(msg(seq), true)
+				}
+				t.Due(now.Add(2*timeout), timeout, maxAttempts)
+				return t.Due(now.Add(4*timeout), timeout, maxAttempts)
+			},
+			wantGaps: []GapMessage{
+				{RoomID: "room", From: 1, To: 2},
+				{RoomID: "room", From: 4, To: 4},
+			},
+		},
+		{
+			name:       "overflow gives up on the oldest",
+			maxPending: 2,
+			run: func(t *DeliveryTracker, now time.Time) ([]Message, []GapMessage) {
+				for seq := int64(1); seq <= 3; seq++ {
+					t.Track(msg(seq), false)
+				}
+				return t.Due(now, timeout, maxAttempts)
+			},
+			wantDue:  []int64{2, 3},
+			wantGaps: []GapMessage{{RoomID: "room", From: 1, To: 1}},
+		},
+		{
+			name: "reset forgets the last room",
+			run: func(t *DeliveryTracker, now time.Time) ([]Message, []GapMessage) {
+				t.Ack(5)
+				t.Track(msg(6), false)
+				t.Reset("other")
+				t.Track(msg(1), false)
+				return t.Due(now, timeout, maxAttempts)
+			},
+			wantDue: []int64{1},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			maxPending := tt.maxPending
+			if maxPending == 0 {
+				maxPending = 100
+			}
+			tracker := NewDeliveryTracker(maxPending)
+			tracker.Reset("room")
+
+			due, gaps := tt.run(tracker, time.Now())
+			var seqs []int64
+			for _, m := range due {
+				seqs = append(seqs, m.Seq)
+			}
+			if !slices.Equal(seqs, tt.wantDue) {
+				t.Errorf("due %v, want %v", seqs, tt.wantDue)
+			}
+			if !slices.Equal(gaps, tt.wantGaps) {
+				t.Errorf("gaps %v, want %v", gaps, tt.wantGaps)
+			}
+		})
+	}
+}
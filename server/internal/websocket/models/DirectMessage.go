@@ -0,0 +1,15 @@
+package models
+
+// DirectSent confirms a "direct" frame to its sender. Queued is set when the
+// recipient is a stored identity and will get the message on its next
+// connect if it is offline now.
+type DirectSent struct {
+	ID     string `json:"id"`
+	To     string `json:"to"`
+	Queued bool   `json:"queued"`
+}
+
+// DirectAck removes received direct messages from the client's offline queue.
+type DirectAck struct {
+	IDs []string `json:"ids"`
+}
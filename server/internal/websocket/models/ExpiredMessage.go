@@ -0,0 +1,6 @@
+package models
+
+type ExpiredMessage struct {
+	RoomID string   `json:"roomId"`
+	IDs    []string `json:"ids"`
+}
@@ -0,0 +1,44 @@
+package models
+
+// FileBegin starts an upload with "file_begin", or resumes one when FileID
+// names an unfinished upload of the client's. Metadata is encrypted by the
+// client, like the content.
+type FileBegin struct {
+	FileID   string `json:"fileId,omitempty"`
+	Size     int64  `json:"size,omitempty"`
+	Metadata []byte `json:"metadata,omitempty"`
+}
+
+// FileReady tells the uploader the offset to send the next chunk from.
+type FileReady struct {
+	FileID string `json:"fileId"`
+	Offset int64  `json:"offset"`
+	Size   int64  `json:"size"`
+}
+
+// FileChunk carries ciphertext in both directions: "file_chunk" frames of an
+// upload, and replies to "file_get". EOF marks the last chunk of a download.
+type FileChunk struct {
+	FileID string `json:"fileId"`
+	Offset int64  `json:"offset"`
+	Data   []byte `json:"data"`
+	EOF    bool   `json:"eof,omitempty"`
+}
+
+// FileRequest names a file in "file_end" and asks for up to Length bytes from
+// Offset in "file_get".
+type FileRequest struct {
+	FileID string `json:"fileId"`
+	Offset int64  `json:"offset,omitempty"`
+	Length int    `json:"length,omitempty"`
+}
+
+// FileMessage announces a finished upload to the room.
+type FileMessage struct {
+	RoomID   string `json:"roomId"`
+	FileID   string `json:"fileId"`
+	Size     int64  `json:"size"`
+	Metadata []byte `json:"metadata,omitempty"`
+	Sender   string `json:"sender,omitempty"`
+	Handle   string `json:"handle,omitempty"`
+}
@@ -0,0 +1,9 @@
+package models
+
+// GapMessage tells a client that room messages From through To could not be
+// delivered. They can be fetched with a history request since From-1.
+type GapMessage struct {
+	RoomID string `json:"roomId"`
+	From   int64  `json:"from"`
+	To     int64  `json:"to"`
+}
@@ -0,0 +1,8 @@
+package models
+
+type HistoryMessage struct {
+	RoomID   string    `json:"roomId"`
+	ThreadID string    `json:"threadId,omitempty"`
+	Messages []Message `json:"messages"`
+	HasMore  bool      `json:"hasMore"`
+}
@@ -0,0 +1,12 @@
+package models
+
+// HistoryRequest pages through the current room's stored messages. Since
+// moves forward from a known sequence (catching up after a reconnect),
+// Before moves back from the oldest sequence a client has seen. A
+// "thread_history" request pages through the thread named by ThreadID.
+type HistoryRequest struct {
+	Since    int64  `json:"since,omitempty"`
+	Before   int64  `json:"before,omitempty"`
+	Limit    int    `json:"limit,omitempty"`
+	ThreadID string `json:"threadId,omitempty"`
+}
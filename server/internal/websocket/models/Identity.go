@@ -0,0 +1,16 @@
+package models
+
+// Identity is a client's verified Ed25519 public key.
+type Identity struct {
+	PublicKey   []byte `json:"publicKey"`
+	Fingerprint string `json:"fingerprint"`
+}
+
+// IdentityMessage registers an identity: Signature covers the session
+// challenge (see crypto.IdentityProof). The server answers with an
+// "identity" event carrying the fingerprint.
+type IdentityMessage struct {
+	PublicKey   []byte `json:"publicKey"`
+	Signature   []byte `json:"signature,omitempty"`
+	Fingerprint string `json:"fingerprint,omitempty"`
+}
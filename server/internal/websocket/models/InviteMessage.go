@@ -0,0 +1,10 @@
+package models
+
+// InviteMessage requests a single-use invite with "create_invite" (TTL in
+// seconds) and carries the code back in an "invite" event.
+type InviteMessage struct {
+	RoomID    string `json:"roomId,omitempty"`
+	Code      string `json:"code,omitempty"`
+	TTL       int64  `json:"ttl,omitempty"`
+	ExpiresAt int64  `json:"expiresAt,omitempty"` // unix millis
+}
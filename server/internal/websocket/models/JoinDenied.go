@@ -0,0 +1,17 @@
+package models
+
+// Reasons a join can be refused.
+const (
+	DeniedToken       = "token"    // the connection token is bound to another room
+	DeniedPassword    = "password" // missing or wrong password
+	DeniedInvite      = "invite"   // missing, used or expired invite
+	DeniedFull        = "full"
+	DeniedBanned      = "banned"
+	DeniedLocked      = "locked"
+	DeniedUnavailable = "unavailable"
+)
+
+type JoinDenied struct {
+	RoomID string `json:"roomId"`
+	Reason string `json:"reason"`
+}
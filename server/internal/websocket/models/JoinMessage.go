@@ -2,4 +2,11 @@ package models
 
 type JoinMessage struct {
 	RoomID string `json:"roomId"`
+	Since  int64  `json:"since,omitempty"`
+	Limit  int    `json:"limit,omitempty"`
+	// Handle is the display name shown to other members
+	Handle string `json:"handle,omitempty"`
+	// Credentials for password and invite-only rooms
+	PasswordHash string `json:"passwordHash,omitempty"`
+	Invite       string `json:"invite,omitempty"`
 }
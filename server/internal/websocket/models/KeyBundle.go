@@ -0,0 +1,8 @@
+package models
+
+// KeyBundle is a client's X25519 public key for room key exchange. The
+// fingerprint is computed by the server.
+type KeyBundle struct {
+	PublicKey   []byte `json:"publicKey"`
+	Fingerprint string `json:"fingerprint,omitempty"`
+}
@@ -0,0 +1,9 @@
+package models
+
+// KeyShare carries a room key sealed for one recipient, addressed by key
+// fingerprint. The server fills in From and relays Share untouched.
+type KeyShare struct {
+	From  string `json:"from,omitempty"`
+	To    string `json:"to"`
+	Share []byte `json:"share"`
+}
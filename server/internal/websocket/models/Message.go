@@ -2,11 +2,45 @@ package models
 
 import (
 	"encoding/json"
+	"time"
 )
 
 type Message struct {
+	ID        string          `json:"id,omitempty"`
+	Seq       int64           `json:"seq,omitempty"`
 	Type      string          `json:"type"`
 	Payload   json.RawMessage `json:"payload"`
 	Timestamp int64           `json:"timestamp,omitempty"`
-	SessionID string          `json:"sessionId,omitempty"`
+	TTL       int64           `json:"ttl,omitempty"`       // seconds, set by the sender
+	ExpiresAt int64           `json:"expiresAt,omitempty"` // unix millis, set by the server
+	// Epoch is the room epoch the sender encrypted for, if it uses sender keys
+	Epoch uint64 `json:"epoch,omitempty"`
+	// Recipient restricts delivery to the member with this key fingerprint
+	Recipient string `json:"recipient,omitempty"`
+	// Signature is the sender's Ed25519 signature over the frame (see
+	// crypto.MessageSigningInput, or crypto.EditSigningInput once EditedAt is
+	// set); Sender is the fingerprint of the identity key it was verified
+	// against, stamped by the server.
+	Signature []byte `json:"signature,omitempty"`
+	Sender    string `json:"sender,omitempty"`
+	// To addresses a direct message to a handle or identity fingerprint;
+	// Handle is the sender's display handle, stamped by the server.
+	To     string `json:"to,omitempty"`
+	Handle string `json:"handle,omitempty"`
+	// ReplyTo is the message this one answers. ThreadID, the first message of
+	// the thread, is derived from it by the server; signed messages must carry
+	// the derived value.
+	ReplyTo  string `json:"replyTo,omitempty"`
+	ThreadID string `json:"threadId,omitempty"`
+	// EditedAt is when the payload was last replaced (unix millis); Reactions
+	// maps each emoji to the fingerprints or member IDs that reacted with it.
+	EditedAt  int64               `json:"editedAt,omitempty"`
+	Reactions map[string][]string `json:"reactions,omitempty"`
+	// Origin is the session a frame came from, which it is not echoed back
+	// to. It is set by the server and never leaves the replica.
+	Origin string `json:"-"`
+}
+
+func (m Message) Expired(now time.Time) bool {
+	return m.ExpiresAt != 0 && now.UnixMilli() >= m.ExpiresAt
 }
@@ -0,0 +1,13 @@
+package models
+
+// ModerationMessage is sent by the room owner in "kick", "ban", "mute",
+// "lock" and "unlock" frames (Duration in seconds), and broadcast to the room
+// as a "moderation" event once applied. Target is a member ID from presence,
+// a session ID or a key fingerprint.
+type ModerationMessage struct {
+	RoomID   string `json:"roomId,omitempty"`
+	Action   string `json:"action,omitempty"`
+	Target   string `json:"target,omitempty"`
+	Duration int64  `json:"duration,omitempty"`
+	Until    int64  `json:"until,omitempty"` // unix millis
+}
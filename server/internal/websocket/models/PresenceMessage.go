@@ -0,0 +1,23 @@
+package models
+
+// PresenceMessage announces a member by display handle and member ID, and by
+// identity key if it registered one, never by session: "joined",
+// "identified" and "left" in "presence" events, "typing" in "typing" events.
+type PresenceMessage struct {
+	RoomID   string    `json:"roomId"`
+	Handle   string    `json:"handle"`
+	MemberID string    `json:"memberId"`
+	Status   string    `json:"status"`
+	Identity *Identity `json:"identity,omitempty"`
+}
+
+// RosterMessage answers a "roster" request with the members of a room.
+type RosterMessage struct {
+	RoomID  string         `json:"roomId"`
+	Members []RosterMember `json:"members"`
+}
+
+type RosterMember struct {
+	Handle   string `json:"handle"`
+	MemberID string `json:"memberId"`
+}
@@ -0,0 +1,10 @@
+package models
+
+// Reaction is the payload of a "react" frame, which references the message by
+// its ID. Reactor is stamped by the server on the relayed event: the identity
+// fingerprint or, without one, the member ID of whoever reacted.
+type Reaction struct {
+	Emoji   string `json:"emoji"`
+	Remove  bool   `json:"remove,omitempty"`
+	Reactor string `json:"reactor,omitempty"`
+}
@@ -0,0 +1,19 @@
+package models
+
+// ReadMessage is the payload of a "read" frame: the client has read its room
+// up to and including Seq.
+type ReadMessage struct {
+	Seq int64 `json:"seq"`
+}
+
+// ReceiptsMessage reports how far members have read a room. Reader is a
+// member's identity fingerprint, or its member ID without one.
+type ReceiptsMessage struct {
+	RoomID  string        `json:"roomId"`
+	Readers []ReadReceipt `json:"readers"`
+}
+
+type ReadReceipt struct {
+	Reader string `json:"reader"`
+	Seq    int64  `json:"seq"`
+}
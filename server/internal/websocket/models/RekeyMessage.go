@@ -0,0 +1,10 @@
+package models
+
+// RekeyMessage tells room members that membership changed: every member
+// should start a new sender key for Epoch and share it with the current
+// members only.
+type RekeyMessage struct {
+	RoomID string `json:"roomId"`
+	Epoch  uint64 `json:"epoch"`
+	Reason string `json:"reason"` // "join" or "leave"
+}
@@ -0,0 +1,5 @@
+package models
+
+type RoomExpiredMessage struct {
+	RoomID string `json:"roomId"`
+}
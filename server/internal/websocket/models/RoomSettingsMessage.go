@@ -0,0 +1,13 @@
+package models
+
+// RoomSettingsMessage is sent by the owner in "configure_room" frames and to
+// members in "room_settings" events. PasswordHash is only ever read from the
+// owner and never sent back. IsOwner tells the recipient it owns the room.
+type RoomSettingsMessage struct {
+	RoomID       string `json:"roomId"`
+	IsOwner      bool   `json:"isOwner,omitempty"`
+	Policy       string `json:"policy"`
+	PasswordHash string `json:"passwordHash,omitempty"`
+	MaxMembers   int    `json:"maxMembers,omitempty"`
+	Locked       bool   `json:"locked,omitempty"`
+}
@@ -0,0 +1,16 @@
+package models
+
+// SessionMessage is sent first on every connection. Reconnecting with
+// ?resume=<ResumeToken> within ResumeWindow seconds restores the session.
+type SessionMessage struct {
+	SessionID    string `json:"sessionId"`
+	ResumeToken  string `json:"resumeToken"`
+	ResumeWindow int64  `json:"resumeWindow"`
+	Resumed      bool   `json:"resumed"`
+	RoomID       string `json:"roomId,omitempty"`
+	// Missed is set when messages arrived faster than they could be buffered
+	// while the session was suspended; the room history has the rest.
+	Missed bool `json:"missed,omitempty"`
+	// Challenge is signed to register an identity key on this connection
+	Challenge []byte `json:"challenge"`
+}
@@ -0,0 +1,71 @@
+package models
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// SlowConsumerMode decides what happens to a message for a client whose
+// send queue is full.
+type SlowConsumerMode int
+
+const (
+	// DropNewest skips the new message; it is retried later, or reported as a
+	// gap to clients that ack.
+	DropNewest SlowConsumerMode = iota
+	// DropOldest evicts the oldest queued message to make room.
+	DropOldest
+	// Disconnect closes the client's connection.
+	Disconnect
+	// Block waits up to the policy deadline for room, then disconnects.
+	Block
+)
+
+const defaultBlockDeadline = time.Second
+
+var slowConsumerModes = map[SlowConsumerMode]string{
+	DropNewest: "drop-newest",
+	DropOldest: "drop-oldest",
+	Disconnect: "disconnect",
+	Block:      "block",
+}
+
+func (m SlowConsumerMode) String() string {
+	if name, ok := slowConsumerModes[m]; ok {
+		return name
+	}
+	return fmt.Sprintf("SlowConsumerMode(%d)", int(m))
+}
+
+type SlowConsumerPolicy struct {
+	Mode     SlowConsumerMode
+	Deadline time.Duration // only used by Block
+}
+
+// ParseSlowConsumerPolicy parses a mode name, optionally followed by a
+// deadline for block, e.g. "drop-oldest" or "block:250ms".
+func ParseSlowConsumerPolicy(s string) (SlowConsumerPolicy, error) {
+	name, deadline, hasDeadline := strings.Cut(s, ":")
+	for mode, modeName := range slowConsumerModes {
+		if modeName != name {
+			continue
+		}
+		policy := SlowConsumerPolicy{Mode: mode}
+		if mode == Block {
+			policy.Deadline = defaultBlockDeadline
+		}
+		if hasDeadline {
+			if mode != Block {
+				return SlowConsumerPolicy{}, fmt.Errorf("slow consumer policy %q takes no deadline", name)
+			}
+			d, err := time.ParseDuration(deadline)
+			if err != nil {
+				return SlowConsumerPolicy{}, err
+			}
+			policy.Deadline = d
+		}
+		return policy, nil
+	}
+	return SlowConsumerPolicy{}, fmt.Errorf("unknown slow consumer policy %q", name)
+}
@@ -0,0 +1,35 @@
+package models
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseSlowConsumerPolicy(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    SlowConsumerPolicy
+		wantErr bool
+	}{
+		{in: "drop-newest", want: SlowConsumerPolicy{Mode: DropNewest}},
+		{in: "drop-oldest", want: SlowConsumerPolicy{Mode: DropOldest}},
+		{in: "disconnect", want: SlowConsumerPolicy{Mode: Disconnect}},
+		{in: "block", want: SlowConsumerPolicy{Mode: Block, Deadline: time.Second}},
+		{in: "block:250ms", want: SlowConsumerPolicy{Mode: Block, Deadline: 250 * time.Millisecond}},
+		{in: "block:soon", wantErr: true},
+		{in: "drop-oldest:1s", wantErr: true},
+		{in: "", wantErr: true},
+		{in: "drop", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := ParseSlowConsumerPolicy(tt.in)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,85 @@
+package models
+
+import (
+	"sync"
+	"time"
+)
+
+// SuspendedSession is what remains of a client after its connection dropped.
+// Room traffic is buffered until the client resumes or the grace window ends.
+type SuspendedSession struct {
+	SessionID   string
+	ResumeToken string
+	AllowedRoom string
+	Handle      string
+	// Aliases are what moderation can target the session by in its room, Key
+	// is what it can be banned by (see Client.Key)
+	Aliases   []string
+	Key       string
+	ExpiresAt time.Time
+
+	mu       sync.Mutex
+	roomID   string
+	buffer   []Message
+	capacity int
+	overflow bool
+	resumed  bool
+}
+
+func NewSuspendedSession(client *Client, expiresAt time.Time, capacity int) *SuspendedSession {
+	return &SuspendedSession{
+		SessionID:   client.SessionID,
+		ResumeToken: client.ResumeToken,
+		AllowedRoom: client.AllowedRoom,
+		Handle:      client.Handle(),
+		Aliases:     client.RoomAliases(client.RoomID()),
+		Key:         client.Key(),
+		ExpiresAt:   expiresAt,
+		roomID:      client.RoomID(),
+		capacity:    capacity,
+	}
+}
+
+func (s *SuspendedSession) RoomID() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.roomID
+}
+
+// Detach removes the session from its room, buffering msg to explain why.
+func (s *SuspendedSession) Detach(msg Message) {
+	s.Buffer(msg)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.roomID = ""
+}
+
+// Buffer keeps msg for delivery on resume. Once the buffer is full further
+// messages are dropped and the overflow is reported on resume.
+func (s *SuspendedSession) Buffer(msg Message) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.resumed {
+		return
+	}
+	if len(s.buffer) >= s.capacity {
+		s.overflow = true
+		return
+	}
+	s.buffer = append(s.buffer, msg)
+}
+
+// Resume hands out the room to rejoin and the buffered messages exactly once.
+func (s *SuspendedSession) Resume() (roomID string, buffered []Message, overflow bool, ok bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.resumed {
+		return "", nil, false, false
+	}
+	s.resumed = true
+	buffered, s.buffer = s.buffer, nil
+	return s.roomID, buffered, s.overflow, true
+}
@@ -0,0 +1,14 @@
+package models
+
+// ThreadSubscription is the payload of "subscribe_thread" and
+// "unsubscribe_thread".
+type ThreadSubscription struct {
+	ThreadID string `json:"threadId"`
+}
+
+// ThreadsMessage lists the threads a client follows in its room. An empty
+// list means it receives the whole room.
+type ThreadsMessage struct {
+	RoomID    string   `json:"roomId"`
+	ThreadIDs []string `json:"threadIds"`
+}
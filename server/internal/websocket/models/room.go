@@ -1,8 +1,261 @@
 package models
 
-import "sync"
+import (
+	"errors"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	ErrRoomClosed = errors.New("room closed")
+	ErrRoomFull   = errors.New("room is full")
+)
 
 type Room struct {
-	ID      string
-	Members sync.Map // map[string]*Client
+	ID        string
+	Members   sync.Map // map[string]*Client
+	Suspended sync.Map // map[string]*SuspendedSession
+	// Sequencer is held from storing a message until it is broadcast, so
+	// that members receive messages in sequence order
+	Sequencer sync.Mutex
+
+	mu           sync.Mutex
+	closed       bool
+	lastActivity atomic.Int64 // unix nanos
+	epoch        atomic.Uint64
+	mutes        sync.Map          // map[string]time.Time (alias -> until)
+	remote       map[string]string // member ID -> handle on other replicas, guarded by mu
+}
+
+func NewRoom(id string) *Room {
+	room := &Room{ID: id}
+	room.Touch()
+	return room
+}
+
+func (r *Room) Touch() {
+	r.lastActivity.Store(time.Now().UnixNano())
+}
+
+func (r *Room) IdleFor(now time.Time) time.Duration {
+	return now.Sub(time.Unix(0, r.lastActivity.Load()))
+}
+
+// Epoch counts membership changes; members rekey whenever it advances.
+func (r *Room) Epoch() uint64 {
+	return r.epoch.Load()
+}
+
+func (r *Room) NextEpoch() uint64 {
+	return r.epoch.Add(1)
+}
+
+// AdvanceEpoch moves the epoch forward to at least epoch, e.g. when another
+// replica saw a membership change first.
+func (r *Room) AdvanceEpoch(epoch uint64) {
+	for {
+		current := r.epoch.Load()
+		if current >= epoch || r.epoch.CompareAndSwap(current, epoch) {
+			return
+		}
+	}
+}
+
+// Roster returns the connected members, including those other replicas
+// announced.
+func (r *Room) Roster() []RosterMember {
+	var members []RosterMember
+	r.Members.Range(func(_, value interface{}) bool {
+		client := value.(*Client)
+		members = append(members, RosterMember{Handle: client.Handle(), MemberID: MemberID(r.ID, client.SessionID)})
+		return true
+	})
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for memberID, handle := range r.remote {
+		members = append(members, RosterMember{Handle: handle, MemberID: memberID})
+	}
+	return members
+}
+
+// ObservePresence tracks a member of another replica joining or leaving.
+func (r *Room) ObservePresence(memberID, handle string, joined bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.remote == nil {
+		r.remote = make(map[string]string)
+	}
+	if joined {
+		r.remote[memberID] = handle
+	} else {
+		delete(r.remote, memberID)
+	}
+}
+
+// Mute silences a member ID, session ID or key fingerprint until the given
+// time.
+func (r *Room) Mute(target string, until time.Time) {
+	r.mutes.Store(target, until)
+}
+
+// Muted reports whether the client is muted by any of its aliases.
+func (r *Room) Muted(client *Client) bool {
+	now := time.Now()
+	for _, target := range client.RoomAliases(r.ID) {
+		if until, ok := r.mutes.Load(target); ok {
+			if until.(time.Time).After(now) {
+				return true
+			}
+			r.mutes.CompareAndDelete(target, until)
+		}
+	}
+	return false
+}
+
+// Remove takes every member matching target, by member ID, session ID or key
+// fingerprint, out of the room and returns them.
+func (r *Room) Remove(target string) []*Client {
+	var removed []*Client
+	r.Members.Range(func(key, value interface{}) bool {
+		client := value.(*Client)
+		if slices.Contains(client.RoomAliases(r.ID), target) && r.Members.CompareAndDelete(key, client) {
+			removed = append(removed, client)
+		}
+		return true
+	})
+	return removed
+}
+
+// RemoveSuspended does the same as Remove for suspended sessions.
+func (r *Room) RemoveSuspended(target string) []*SuspendedSession {
+	var removed []*SuspendedSession
+	r.Suspended.Range(func(key, value interface{}) bool {
+		session := value.(*SuspendedSession)
+		if slices.Contains(session.Aliases, target) && r.Suspended.CompareAndDelete(key, session) {
+			removed = append(removed, session)
+		}
+		return true
+	})
+	return removed
+}
+
+// Key resolves a member ID or session ID to the key of the member it names
+// (see Client.Key); key fingerprints are returned as they are. member is
+// false if no member on this replica, or announced by another one, matches
+// target; key is empty if the member has no key or it is unknown here.
+func (r *Room) Key(target string) (key string, member bool) {
+	match := func(aliases []string, sessionID, memberKey string) {
+		if !slices.Contains(aliases, target) {
+			return
+		}
+		member = true
+		key = target
+		if target == sessionID || target == MemberID(r.ID, sessionID) {
+			key = memberKey
+		}
+	}
+	r.Members.Range(func(_, value interface{}) bool {
+		client := value.(*Client)
+		match(client.RoomAliases(r.ID), client.SessionID, client.Key())
+		return !member
+	})
+	if !member {
+		r.Suspended.Range(func(_, value interface{}) bool {
+			session := value.(*SuspendedSession)
+			match(session.Aliases, session.SessionID, session.Key)
+			return !member
+		})
+	}
+	if member {
+		return key, true
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	_, member = r.remote[target]
+	return "", member
+}
+
+// Add stores client as a member. It fails with ErrRoomClosed if the janitor
+// has closed the room, in which case the caller must look the room up again,
+// and with ErrRoomFull if maxMembers others are already in it. Zero
+// maxMembers means no limit. Members are counted on this replica only.
+func (r *Room) Add(client *Client, maxMembers int) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.closed {
+		return ErrRoomClosed
+	}
+	if maxMembers > 0 && r.countOthers(client.SessionID) >= maxMembers {
+		return ErrRoomFull
+	}
+	r.Members.Store(client.SessionID, client)
+	r.Touch()
+	return nil
+}
+
+// countOthers counts connected and suspended members other than sessionID.
+func (r *Room) countOthers(sessionID string) int {
+	n := 0
+	count := func(key, _ interface{}) bool {
+		if key.(string) != sessionID {
+			n++
+		}
+		return true
+	}
+	r.Members.Range(count)
+	r.Suspended.Range(count)
+	return n
+}
+
+func (r *Room) Has(sessionID string) bool {
+	_, ok := r.Members.Load(sessionID)
+	return ok
+}
+
+// Empty reports whether the room has neither connected nor suspended members.
+func (r *Room) Empty() bool {
+	empty := true
+	stop := func(_, _ interface{}) bool {
+		empty = false
+		return false
+	}
+	r.Members.Range(stop)
+	if empty {
+		r.Suspended.Range(stop)
+	}
+	return empty
+}
+
+// CloseIfEmpty closes the room when nobody is in it, so that it can be
+// dropped without racing a concurrent Add.
+func (r *Room) CloseIfEmpty() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.closed || !r.Empty() {
+		return r.closed
+	}
+	r.closed = true
+	return true
+}
+
+// Close closes the room and returns the members it still had.
+func (r *Room) Close() []*Client {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.closed = true
+	var members []*Client
+	r.Members.Range(func(key, value interface{}) bool {
+		members = append(members, value.(*Client))
+		r.Members.Delete(key)
+		return true
+	})
+	return members
 }